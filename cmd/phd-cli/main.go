@@ -0,0 +1,509 @@
+// Command phd-cli converts csv exports to LaTeX, html, markdown or
+// text tables, inspects them and runs job files.
+//
+//	phd-cli convert -o materials.tex -skip 4 -columns 0,1,9,8,11-15 j56.csv
+//	phd-cli inspect -skip 4 j56.csv
+//	phd-cli batch report.json
+//	phd-cli watch report.json
+//	phd-cli help convert
+//
+// The exit status is 0 on success, 1 if a table could not be
+// rendered and 2 if the command line is wrong, so that the command
+// can drive Makefiles and latexmk.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"ml/table"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// errUsage is returned for a wrong command line.
+var errUsage = errors.New("usage")
+
+// command is a subcommand of phd-cli.
+type command struct {
+	name, args, summary string
+	flags               func(fs *flag.FlagSet, stdout, stderr io.Writer) func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"convert", "[flags] input.csv", "convert a csv file to a .tex, .html, .md or .txt table", convertFlags},
+		{"inspect", "[flags] input.csv", "show the columns detected, their types and the number of rows", inspectFlags},
+		{"batch", "[flags] jobs.json", "render the tables of a job file concurrently", batchFlags},
+		{"watch", "[flags] jobs.json...", "render the tables of job files again whenever their csv changes", watchFlags},
+		{"help", "[command]", "print the usage of phd-cli or of a command", nil},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	name, args := args[0], args[1:]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		return help(args, stdout, stderr)
+	}
+	cmd, ok := lookup(name)
+	if !ok {
+		fmt.Fprintf(stderr, "phd-cli: unknown command %q\n", name)
+		usage(stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { commandUsage(fs, cmd, stderr) }
+	exec := cmd.flags(fs, stdout, stderr)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	err := exec(fs.Args())
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		return exitUsage
+	}
+	fmt.Fprintf(stderr, "phd-cli %s: %v\n", cmd.name, err)
+	return exitFail
+}
+
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "phd-cli %s converts csv exports to tables\n\n", table.Version)
+	fmt.Fprintf(w, "usage: phd-cli <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nexit status: 0 success, 1 failure, 2 wrong usage\n")
+	fmt.Fprintf(w, "run \"phd-cli help <command>\" for the flags of a command\n")
+}
+
+func commandUsage(fs *flag.FlagSet, cmd command, w io.Writer) {
+	fmt.Fprintf(w, "usage: phd-cli %s %s\n\n%s\n\n", cmd.name, cmd.args, cmd.summary)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func help(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stdout)
+		return exitOK
+	}
+	cmd, ok := lookup(args[0])
+	if !ok || cmd.flags == nil {
+		if !ok {
+			fmt.Fprintf(stderr, "phd-cli: unknown command %q\n", args[0])
+			return exitUsage
+		}
+		usage(stdout)
+		return exitOK
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	cmd.flags(fs, stdout, stderr)
+	commandUsage(fs, cmd, stdout)
+	return exitOK
+}
+
+// list is a flag that can be repeated.
+type list []string
+
+func (l *list) String() string     { return strings.Join(*l, " ") }
+func (l *list) Set(s string) error { *l = append(*l, s); return nil }
+
+// options are the flags that configure a table.
+type options struct {
+	skip, headerLines int
+	columns, raw      string
+	header            list
+	safe, trim, fill  bool
+	noHeader          bool
+	allow, errors     string
+	reader, comment   string
+	encoding          string
+}
+
+func (o *options) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.reader, "reader", "", "input: csv, tsv, whitespace, fixed, fixed:8,20,40, auto, xlsx:sheet!range, ods:sheet!range, json:explode, jsonl:explode or a delimiter such as ;, from the extension if empty")
+	fs.StringVar(&o.encoding, "encoding", "", "encoding of the input: utf-8, utf-16le, utf-16be, windows-1252 or windows-1256, sniffed if empty")
+	fs.StringVar(&o.comment, "comment", "", "prefix of the comment lines to skip, such as #")
+	fs.BoolVar(&o.trim, "trim", false, "trim the padding around the fields of a delimited input")
+	fs.BoolVar(&o.fill, "fill-merged", false, "repeat the value of the merged cells of a workbook on all the cells they cover")
+	fs.IntVar(&o.skip, "skip", 0, "number of lines to skip before the data")
+	fs.IntVar(&o.headerLines, "header-lines", 0, "number of header rows in the csv, the first names the columns")
+	fs.BoolVar(&o.noHeader, "no-header", false, "read the first rows as data, even if a header was sniffed")
+	fs.StringVar(&o.columns, "columns", "", "comma separated columns: indices, names, ranges 4-6, letters C:F, /regex/, !exclusions")
+	fs.StringVar(&o.raw, "raw", "", "comma separated columns of raw LaTeX, written unescaped")
+	fs.Var(&o.header, "header", "comma separated header row, repeat for more rows")
+	fs.BoolVar(&o.safe, "safe", false, "neutralise the control sequences of the raw columns, for untrusted csv files")
+	fs.StringVar(&o.allow, "allow", "", "comma separated control words allowed by -safe, instead of the defaults")
+	fs.StringVar(&o.errors, "errors", "default", "spreadsheet error values such as #N/A: default, dash, token, zero, blank or fail")
+}
+
+// apply configures the table to read the input.
+func (o *options) apply(t *table.Table, input string) error {
+	reader := o.reader
+	if reader == "" {
+		reader = readers[strings.ToLower(filepath.Ext(input))]
+	}
+	in, err := table.NewInput(reader, table.LineOptions{Comment: o.comment, Trim: o.trim, FillMerged: o.fill})
+	if err != nil {
+		return err
+	}
+	t.Input = in
+	t.Encoding = o.encoding
+	t.SkipN = o.skip
+	if o.headerLines > 0 {
+		t.HasHeader = true
+		t.HeaderLines = o.headerLines
+	}
+	if o.noHeader {
+		t.HeaderMode = table.HeaderNo
+	}
+	for _, row := range o.header {
+		t.Header.AddHeader(strings.Split(row, ",")...)
+	}
+	if o.columns != "" {
+		t.ColumnsByName(selection(o.columns)...)
+	}
+	if o.raw != "" {
+		t.RawColumns(selection(o.raw)...)
+	}
+	t.Safe = o.safe
+	if o.allow != "" {
+		t.SafeCommands = strings.Split(o.allow, ",")
+	}
+	policy, err := table.ParseErrorPolicy(o.errors)
+	if err != nil {
+		return err
+	}
+	t.ErrorValues = policy
+	return nil
+}
+
+// selection splits a comma separated selection into
+// the indices and names of ColumnsByName.
+func selection(s string) []interface{} {
+	var sel []interface{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if k, err := strconv.Atoi(c); err == nil {
+			sel = append(sel, k)
+		} else {
+			sel = append(sel, c)
+		}
+	}
+	return sel
+}
+
+// clean cleans the input file, or the standard input for "-".
+func clean(t *table.Table, input string) error {
+	if input == "-" {
+		_, err := t.CleanReader(os.Stdin)
+		return err
+	}
+	_, err := t.Clean(input)
+	return err
+}
+
+// warn prints the diagnostics of a table.
+func warn(w io.Writer, t *table.Table) {
+	for _, err := range t.Diagnostics {
+		fmt.Fprintf(w, "warning: %v\n", err)
+	}
+	if t.DroppedDiagnostics > 0 {
+		fmt.Fprintf(w, "warning: %d more problems not listed\n", t.DroppedDiagnostics)
+	}
+}
+
+// formats maps the extension of the output to a format.
+var formats = map[string]string{
+	".tex":  "latex",
+	".html": "html",
+	".htm":  "html",
+	".md":   "markdown",
+	".txt":  "text",
+}
+
+// readers maps the extensions of the inputs to their
+// reader, when -reader is not given. Others are csv.
+var readers = map[string]string{
+	".tsv":    "tsv",
+	".tab":    "tsv",
+	".xlsx":   "xlsx",
+	".ods":    "ods",
+	".json":   "json",
+	".jsonl":  "jsonl",
+	".ndjson": "jsonl",
+}
+
+func convertFlags(fs *flag.FlagSet, stdout, stderr io.Writer) func(args []string) error {
+	var o options
+	o.flags(fs)
+	output := fs.String("o", "", "output file, its extension chooses the format; the standard output if empty")
+	format := fs.String("format", "", "latex, html, markdown or text, instead of the extension of -o")
+	typ := fs.String("type", "longtable", "LaTeX table environment")
+	palette := fs.String("palette", "", "colour palette of the table")
+	caption := fs.String("caption", "", "caption of the table")
+	label := fs.String("label", "", "label to reference the table")
+	sections := fs.Bool("sections", false, "act on the subtotal and section rows, as SectionCSV")
+	sum := fs.Bool("sum", false, "add section subtotals and a grand total")
+	titles := fs.String("titles", "", "section titles, a .json or .csv file of prefix to title")
+	var props list
+	fs.Var(&props, "prop", "table property as key=value, repeat for more")
+
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		t := table.New()
+		if err := o.apply(t, args[0]); err != nil {
+			return err
+		}
+
+		f := *format
+		if f == "" {
+			f = formats[strings.ToLower(filepath.Ext(*output))]
+		}
+		rd, err := table.NewRenderer(f)
+		if err != nil {
+			return err
+		}
+		t.Renderer = rd
+
+		prop := map[string]string{"type": *typ}
+		if *palette != "" {
+			prop["palette"] = *palette
+		}
+		for _, p := range props {
+			kv := strings.SplitN(p, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("-prop %q: want key=value", p)
+			}
+			prop[kv[0]] = kv[1]
+		}
+		if *caption != "" {
+			t.Caption(*caption)
+		}
+		if *label != "" {
+			t.RefLabel(*label)
+		}
+		t.HasSections = *sections
+		if *titles != "" {
+			st, err := table.LoadSectionTitles(*titles)
+			if err != nil {
+				return err
+			}
+			t.SectionTitles = st
+		}
+
+		if err := clean(t, args[0]); err != nil {
+			return err
+		}
+		defer warn(stderr, t)
+		if *output != "" && *output != "-" {
+			if *sections {
+				return t.SectionCSV(*output, *sum, prop)
+			}
+			return t.ReadCSV(*output, *sum, prop)
+		}
+		t.Totals.Sections = *sum
+		t.Totals.Grand = *sum
+		r := bytes.NewReader(t.Raw)
+		if *sections {
+			return t.RenderSections(stdout, r, prop)
+		}
+		return t.Render(stdout, r, prop)
+	}
+}
+
+// letters returns the spreadsheet name of a column, 0 is A.
+func letters(k int) string {
+	s := ""
+	for k++; k > 0; k = (k - 1) / 26 {
+		s = string(rune('A'+(k-1)%26)) + s
+	}
+	return s
+}
+
+func inspectFlags(fs *flag.FlagSet, stdout, stderr io.Writer) func(args []string) error {
+	var o options
+	o.flags(fs)
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		t := table.New()
+		if err := o.apply(t, args[0]); err != nil {
+			return err
+		}
+		if err := clean(t, args[0]); err != nil {
+			return err
+		}
+		if err := t.Load(bytes.NewReader(t.Raw)); err != nil {
+			return err
+		}
+		defer warn(stderr, t)
+
+		fmt.Fprintf(stdout, "%s: %d rows, %d columns\n", args[0], t.Rows(), len(t.ColumnInfo()))
+		if t.Sniffed.Encoding != "" {
+			fmt.Fprintf(stdout, "sniffed: %v\n", t.Sniffed)
+		}
+		fmt.Fprintln(stdout)
+		fmt.Fprintf(stdout, "%5s %-4s %-24s %-8s %5s %s\n", "INDEX", "COL", "NAME", "TYPE", "WIDTH", "SPECIFIER")
+		for _, c := range t.ColumnInfo() {
+			name := c.Name
+			if len(name) > 24 {
+				name = name[:21] + "..."
+			}
+			fmt.Fprintf(stdout, "%5d %-4s %-24s %-8s %5d %s\n", c.Index, letters(c.Index), name, c.Type, c.Width, c.Specifier(false, false))
+		}
+		return nil
+	}
+}
+
+func batchFlags(fs *flag.FlagSet, stdout, stderr io.Writer) func(args []string) error {
+	workers := fs.Int("j", runtime.NumCPU(), "number of tables rendered at once")
+	manifest := fs.String("manifest", "", "manifest file; only the tables whose csv or configuration changed are rendered")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		ctx, stop := interruptible()
+		defer stop()
+
+		var errs []error
+		if *manifest == "" {
+			var err error
+			if errs, err = table.RunJobFile(ctx, args[0], *workers); err != nil {
+				return err
+			}
+		} else {
+			jobs, err := table.LoadJobs(args[0])
+			if err != nil {
+				return err
+			}
+			m, err := table.LoadManifest(*manifest)
+			if err != nil {
+				return err
+			}
+			errs = m.Batch(ctx, *workers, jobs...)
+			if err := m.Save(); err != nil {
+				return err
+			}
+			skipped := 0
+			for _, j := range jobs {
+				if j.UpToDate {
+					skipped++
+				}
+			}
+			fmt.Fprintf(stderr, "%d of %d tables up to date\n", skipped, len(jobs))
+		}
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d tables failed", failed, len(errs))
+		}
+		return nil
+	}
+}
+
+// interruptible returns a context cancelled by an interrupt.
+func interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(interrupt)
+		cancel()
+	}
+}
+
+func watchFlags(fs *flag.FlagSet, stdout, stderr io.Writer) func(args []string) error {
+	var w table.Watcher
+	fs.DurationVar(&w.Interval, "interval", 500*time.Millisecond, "time between two looks at the inputs")
+	fs.DurationVar(&w.Debounce, "debounce", time.Second, "time an input must stay unchanged before its tables are rendered")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		var jobs []*table.Job
+		for _, path := range args {
+			j, err := table.LoadJobs(path)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, j...)
+		}
+		w.Report = func(j *table.Job, err error) {
+			now := time.Now().Format("15:04:05")
+			if err != nil {
+				fmt.Fprintf(stderr, "%s %v\n", now, err)
+				return
+			}
+			fmt.Fprintf(stderr, "%s wrote %s\n", now, j.Output)
+			warn(stderr, j.Table)
+		}
+		fmt.Fprintf(stderr, "watching %d tables, interrupt to stop\n", len(jobs))
+
+		ctx, stop := interruptible()
+		defer stop()
+		if err := w.Watch(ctx, jobs...); err != context.Canceled {
+			return err
+		}
+		return nil
+	}
+}
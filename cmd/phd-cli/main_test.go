@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phd-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "costs.csv")
+	if err := ioutil.WriteFile(input, []byte("code,item,qty\nA1,Pipe,2\nA2,Bolt,#N/A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+		stderr []string
+	}{
+		{"convert", []string{"convert", "-header-lines", "1", input}, exitOK,
+			[]string{`\begin{longtable}`, `A1  & Pipe`}, []string{"warning: ", "#N/A in qty"}},
+		{"convert markdown", []string{"convert", "-header-lines", "1", "-format", "markdown", input}, exitOK,
+			[]string{"| code | item |", "| A1 | Pipe | 2 |"}, nil},
+		{"convert sections", []string{"convert", "-header-lines", "1", "-sections", "-format", "text", input}, exitOK,
+			[]string{"Pipe"}, nil},
+		{"inspect", []string{"inspect", "-header-lines", "1", input}, exitOK,
+			[]string{"2 rows, 3 columns", "qty"}, nil},
+		{"unknown column", []string{"convert", "-header-lines", "1", "-columns", "cost", input}, exitFail,
+			nil, []string{`unknown column "cost"`}},
+		{"usage", []string{"convert"}, exitUsage, nil, []string{"usage: phd-cli convert"}},
+		{"help", []string{"help", "inspect"}, exitOK, []string{"usage: phd-cli inspect"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("exit status %d, want %d\n%s", code, tt.code, stderr.String())
+			}
+			for _, s := range tt.stdout {
+				if !strings.Contains(stdout.String(), s) {
+					t.Errorf("stdout lacks %q:\n%s", s, stdout.String())
+				}
+			}
+			for _, s := range tt.stderr {
+				if !strings.Contains(stderr.String(), s) {
+					t.Errorf("stderr lacks %q:\n%s", s, stderr.String())
+				}
+			}
+		})
+	}
+}
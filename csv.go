@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/text/message"
 	"log"
@@ -43,13 +44,43 @@ func openBrowser(url string) bool {
 	return cmd.Start() == nil
 }
 
+// subtotals are the words that start the subtotal rows of
+// the Doha Oasis cost reports.
+var subtotals = map[int][]string{
+	1: {"PREFIX", "SUBTOTAL", "SUBCONTRACTS", "MATERIALS", "TEC-VAR",
+		"CONTRACTS", "CINEMA", "GRAND", "TOTAL"},
+}
+
+// sections maps the codes of the Doha Oasis cost reports to
+// the titles of their sections.
+var sections = map[string]string{
+	"TEC":          "SECTION THEME EXPERIENCE CENTER",
+	"SUB-SMR":      "SECTION SMART SYSTEMS",
+	"SUB-E":        "SECTION SUBCONTRACTS IN CORE CONTRACT",
+	"SUB-M":        "SECTION SUBCONTRACT PS",
+	"GEN":          "SECTION INDIRECT SITE COSTS",
+	"PC-":          "SECTION PC SUMS (All)",
+	"HVAC":         "SECTION HVAC",
+	"EL-EQ":        "SECTION ELECTRICAL",
+	"SUBCONTRACTS": "SECTION SUBCONTRACTS",
+}
+
+// sectionTitles returns the mapping used by the cost reports.
+func sectionTitles() *table.SectionTitles {
+	titles := table.NewSectionTitles(sections)
+	titles.Fallback = "SECTION UNKNOWN"
+	return titles
+}
+
 // Groups
 func Example() {
 	r := table.New()
-	r.Clean("groups.csv") //"j56.csv") //"j56.csv")"sub.csv"
+	if _, err := r.Clean("groups.csv"); err != nil {
+		log.Fatal(err)
+	}
 	// Work on settings
-	//r.SkipFirstN(1)
-	r.SkipN = 1
+	// the first line names the columns selected below
+	r.HasHeader = true
 	r.Landscape = false
 	r.Caption("Group Codes")
 	r.RefLabel("tbl:groups")
@@ -58,8 +89,7 @@ func Example() {
 		{"A", "B", "C"},
 		{"D", "E", "F"},
 	}
-	r.Columns([]int{0, 1, 2})
-	r.ColumnsByName("5-6", "code", "22-25", "short_description", "long_description", 1)
+	r.ColumnsByName("code", "short_description", "long_description")
 	prop := map[string]string{
 		"type":                "longtable",
 		"table-align":         "l",
@@ -84,20 +114,25 @@ func Example() {
                   l|}%`
 
 	// We start procesing here
-	r.ReadCSV("groups.tex", true, prop)
+	if err := r.ReadCSV("groups.tex", true, prop); err != nil {
+		log.Fatal(err)
+	}
 
 }
 
 func ExampleSmart() {
 	r := table.New()
 
-	r.Clean("smartstatus.csv") //"j56.csv") //"j56.csv")"sub.csv"
+	if _, err := r.Clean("smartstatus.csv"); err != nil {
+		log.Fatal(err)
+	}
 	r.Caption("Smart City", "Current Smart City Cost Commitments")
 	r.RefLabel("smartsystems")
 	// Work on settings.csv.
 	//r.SkipFirstN(1).csv
 	r.SkipN = 1
 	r.HasSections = true
+	r.SectionTitles = sectionTitles()
 	r.EmptyToLine = true
 
 	r.Header.M = [][]string{
@@ -127,24 +162,23 @@ func ExampleSmart() {
                   r|r %
                   |c|r|}%`
 
+	r.Trigger.Names = subtotals
 	r.Columns([]int{0, 1, 2, 3, 4, 5, 6})
-	r.SectionCSV("smart.tex", true, prop)
+	if err := r.SectionCSV("smart.tex", false, prop); err != nil {
+		log.Fatal(err)
+	}
 
 }
 
-func main() {
-
-	Example()
-	ExampleSmart()
-
-	//
+// materialsJob renders the material costs of j56.csv.
+func materialsJob() *table.Job {
 	r := table.New()
-	r.Clean("j56.csv")
 	r.Caption("Material Costs")
 	// do load
 	r.SkipN = 4
 
 	r.HasSections = true
+	r.SectionTitles = sectionTitles()
 
 	r.Header.M = [][]string{
 		{"SR", "CAT", "CODE", "DESCRIPTION", "BUDGET", "BUDGET", "CURRENT", "COST AT", "PROJECT."},
@@ -181,14 +215,23 @@ func main() {
                   r?%
                   gV}%`
 
-	r.Trigger.Names = map[int][]string{
-		1: {"PREFIX", "GEN", "GENERAL"},
-		0: {"CONTAINS", "GEN", "GENERAL"},
-	}
+	// rows without a serial number or a projected cost are notes
+	r.AddRule(table.NewRule(0, table.MatchExact, table.SkipRow, ""))
+	r.AddRule(table.NewRule(8, table.MatchExact, table.SkipRow, ""))
+	r.Trigger.Names = subtotals
 
 	r.Columns([]int{0, 1, 9, 8, 11, 12, 13, 14, 15})
-	r.SectionCSV("materials.tex", true, prop)
 
+	// the sheets carry their own subtotals, so we do not ask for
+	// any summation in these tables
+	return &table.Job{Table: r, Input: "j56.csv", Output: "materials.tex", Sections: true, Prop: prop}
+}
+
+// materialsSummaryJob renders the orders of j56.csv, in
+// the style of the material costs.
+func materialsSummaryJob() *table.Job {
+	j := materialsJob()
+	r, prop := j.Table, j.Prop
 	r.Header.M = [][]string{
 		{"Sr", "Cat", "Code", "Description", "Projected", "Cumulative", "Balance", "Delivered", "Percent"},
 		{"", "", "", "", "Cost", "Orders", "Orders", "Orders", ""},
@@ -210,9 +253,14 @@ func main() {
                   l:}%`
 
 	r.Columns([]int{0, 1, 9, 8, 15, 16, 17, 18, 19})
+	j.Output = "materials-summary.tex"
+	return j
+}
 
-	r.SectionCSV("materials-summary.tex", true, prop)
-
+// codesJob renders the codes of j56.csv.
+func codesJob() *table.Job {
+	j := materialsSummaryJob()
+	r, prop := j.Table, j.Prop
 	prop["specifier"] = `{@{\extracolsep{\fill}}|r|%serial 
                    p{1.5cm}|% 
                    r|%
@@ -225,9 +273,16 @@ func main() {
 	prop["thetableheadbgcolor"] = "thetableheadbgcolor"
 
 	r.Columns([]int{0, 1, 9, 10})
-	r.ReadCSV("codes.tex", true, prop)
+	j.Output = "codes.tex"
+	j.Sections = false
+	j.Summation = true
+	return j
+}
 
-	r.Clean("test.csv")
+// testJob renders test.csv as a floating table.
+func testJob() *table.Job {
+	j := codesJob()
+	r, prop := j.Table, j.Prop
 	r.Columns([]int{0, 1, 2, 3, 4})
 	r.Header.M = [][]string{
 		{"Sr", "Cat", "Code", "Description", "Other"},
@@ -243,7 +298,28 @@ func main() {
 	prop["font-size"] = "Large"
 
 	r.Stripe.Activate()
-	r.ReadCSV("test.tex", true, prop)
+	j.Input = "test.csv"
+	j.Output = "test.tex"
+	return j
+}
+
+func main() {
+
+	Example()
+	ExampleSmart()
+
+	// every job has a table of its own, they are rendered concurrently
+	jobs := []*table.Job{materialsJob(), materialsSummaryJob(), codesJob(), testJob()}
+	failed := false
+	for _, err := range table.Batch(context.Background(), runtime.NumCPU(), jobs...) {
+		if err != nil {
+			log.Println(err)
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("some tables could not be rendered")
+	}
 
 	//"--interaction=nonstopmode",
 	cmd := exec.Command("lualatex", "mat.tex", "&& start chrome.exe", "mat.pdf")
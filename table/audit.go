@@ -0,0 +1,134 @@
+package table
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Audit configures the verification of the subtotal rows found in a
+// spreadsheet. Cost reports are exported from sheets where the
+// subtotals are typed or computed upstream and sometimes they are
+// wrong. With the audit on, every subtotal row met by SectionCSV is
+// compared, column by column, with the sum of the detail rows that
+// precede it. The grand total rows, those whose label starts with one
+// of the Grand words, are compared with all the detail rows so far.
+type Audit struct {
+	Enabled bool
+	// Grand are the words that start the labels of the
+	// grand totals, GRAND and TOTAL if nil.
+	Grand []string
+	// Tolerance is the largest difference accepted, as in "0.01".
+	// If empty the figures must match exactly.
+	Tolerance string
+	// Highlight is the colour used for the offending cells
+	// in a LaTeX table. If empty the table is left as is.
+	Highlight string
+}
+
+// Mismatch is a subtotal of the spreadsheet that does not
+// agree with its detail rows.
+type Mismatch struct {
+	File string
+	// Line of the subtotal row in the source.
+	Line int
+	// Column of the figure in the source.
+	Column int
+	// Label is the text that triggered the subtotal.
+	Label    string
+	Found    *big.Rat
+	Computed *big.Rat
+	// Diff is Found less Computed.
+	Diff     *big.Rat
+	decimals int
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s:%d: column %d: %s is %s, the detail rows sum to %s (difference %s)",
+		m.File, m.Line, m.Column, m.Label,
+		m.Found.FloatString(m.decimals), m.Computed.FloatString(m.decimals), m.Diff.FloatString(m.decimals))
+}
+
+// tolerance returns the largest difference accepted.
+func (a Audit) tolerance() (*big.Rat, error) {
+	if a.Tolerance == "" {
+		return new(big.Rat), nil
+	}
+	tol, ok := new(big.Rat).SetString(a.Tolerance)
+	if !ok {
+		return nil, fmt.Errorf("invalid audit tolerance %q", a.Tolerance)
+	}
+	return tol.Abs(tol), nil
+}
+
+// within reports if x and y differ by at most tol.
+func within(x, y, tol *big.Rat) bool {
+	d := new(big.Rat).Sub(x, y)
+	return d.Abs(d).Cmp(tol) <= 0
+}
+
+// isGrand reports if a label is that of a grand total.
+func (a Audit) isGrand(label string) bool {
+	words := a.Grand
+	if words == nil {
+		words = []string{"GRAND", "TOTAL"}
+	}
+	label = strings.ToUpper(strings.TrimSpace(label))
+	for _, w := range words {
+		if strings.HasPrefix(label, strings.ToUpper(w)) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit compares the figures of the subtotal row at line with the sums of
+// the detail rows. The offending cells are marked for the renderer.
+func (t *Table) audit(sums *summing, line int, fields []Field, label string) error {
+	tol, err := t.Audit.tolerance()
+	if err != nil {
+		return err
+	}
+	against := sums.section
+	if t.Audit.isGrand(label) {
+		against = sums.grand
+	}
+	for k, c := range against.columns {
+		if c >= len(fields) || fields[c].num == nil {
+			continue
+		}
+		found := fields[c].num
+		computed := against.sums[k]
+		if within(found, computed, tol) {
+			continue
+		}
+		column := c
+		if c < len(t.selector) {
+			column = t.selector[c]
+		}
+		t.Mismatches = append(t.Mismatches, Mismatch{
+			File:     t.inpath,
+			Line:     line,
+			Column:   column,
+			Label:    strings.TrimSpace(label),
+			Found:    found,
+			Computed: new(big.Rat).Set(computed),
+			Diff:     new(big.Rat).Sub(found, computed),
+			decimals: sums.decimals(c),
+		})
+		fields[c].mark = true
+	}
+	return nil
+}
+
+// WriteAuditReport writes the mismatches found by the last
+// rendering, one per line.
+func (t *Table) WriteAuditReport(w io.Writer) error {
+	for _, m := range t.Mismatches {
+		if _, err := fmt.Fprintln(w, m.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
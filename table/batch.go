@@ -0,0 +1,110 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Job is a table to render on its own. Every job needs a Table of
+// its own, configured as for ReadCSV or SectionCSV: jobs share
+// nothing, so they can be rendered concurrently.
+type Job struct {
+	Table *Table
+	// Input is the csv file, cleaned by the job. Output
+	// is the file written.
+	Input, Output string
+	// Sections renders as SectionCSV, otherwise as ReadCSV.
+	Sections  bool
+	Summation bool
+	Prop      map[string]string
+	// Config identifies the configuration of the Table, which
+	// a Manifest cannot see: change it and the job is rendered
+	// again. The jobs of a job file carry a hash of their spec.
+	Config string
+	// UpToDate is set by Manifest.Batch when the job was
+	// skipped because nothing changed.
+	UpToDate bool
+}
+
+// contextReader stops reading when its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// Run renders the job. The rendering stops, leaving any previous
+// output untouched, if the context is cancelled.
+func (j *Job) Run(ctx context.Context) error {
+	t := j.Table
+	f, err := os.Open(j.Input)
+	if err != nil {
+		return t.fail(err)
+	}
+	defer f.Close()
+	t.inpath = j.Input
+	if _, err := t.CleanReader(contextReader{ctx, f}); err != nil {
+		return err
+	}
+
+	render := t.Render
+	if j.Sections {
+		render = t.RenderSections
+	}
+	t.summation = j.Summation
+	defer func() { t.summation = false }()
+	return t.writeFile(j.Output, func(w io.Writer, r io.Reader) error {
+		return render(w, contextReader{ctx, r}, j.Prop)
+	})
+}
+
+// Batch renders the jobs with a pool of workers, all at once if
+// workers is not positive. It returns the error of every job, in the
+// order of the jobs, nil for those that succeeded. A job that fails
+// does not stop the others; once ctx is cancelled the running jobs
+// stop and the ones left are not started.
+func Batch(ctx context.Context, workers int, jobs ...*Job) []error {
+	errs := make([]error, len(jobs))
+	if workers <= 0 || workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range queue {
+				if err := jobs[k].Run(ctx); err != nil {
+					errs[k] = fmt.Errorf("%s: %w", jobs[k].Output, err)
+				}
+			}
+		}()
+	}
+
+	k := 0
+feed:
+	for ; k < len(jobs); k++ {
+		select {
+		case queue <- k:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	for ; k < len(jobs); k++ {
+		errs[k] = fmt.Errorf("%s: %w", jobs[k].Output, ctx.Err())
+	}
+	return errs
+}
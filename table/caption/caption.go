@@ -19,6 +19,7 @@ package caption
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	//"bufio"
 	//"github.com/golang/net/html/atom"
 )
@@ -90,6 +91,32 @@ func HtmlRenderer(out *bytes.Buffer, options map[string]string) Renderer {
 	return &html{}
 }
 
+// AddToPreamble implements the Renderer interface. It adds the css
+// rules of the caption element to a stylesheet.
+func (h *html) AddToPreamble(out *bytes.Buffer, options map[string]string) {
+	side := "top"
+	if options["position"] == "bottom" {
+		side = "bottom"
+	}
+	out.WriteString("caption {\n")
+	out.WriteString("  caption-side: " + side + ";\n")
+	out.WriteString("  text-align: left;\n")
+	out.WriteString("  font-weight: bold;\n")
+	out.WriteString("  padding: 0.5em 0;\n")
+	out.WriteString("}\n")
+}
+
+func (h *html) Style() {
+
+}
+
+func (h *html) SetCommand() {
+
+}
+
+// htmlEscaper escapes the text of html elements.
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
 func TeXRenderer(out *bytes.Buffer, options map[string]string) Renderer {
 	cs := New()
 	return cs
@@ -156,27 +183,38 @@ type Font struct {
 	FontVariant string
 	FontSize    string
 	Typ         string
+
+	// properties set on this font, the others
+	// have their default value
+	props map[string]string
 }
 
 // use atoms to refer to attributes
-var dict = map[string]string{"font-size": "10pt",
-							 "font-weight": "normal",
-						}
-	
+// fontDefaults are the properties a font starts with. They are
+// never changed, every font keeps its own settings.
+var fontDefaults = map[string]string{
+	"font-size":   "10pt",
+	"font-weight": "normal",
+}
+
 // SetProperty sets any property
 // f.SetProperty("font-size", "12pt")
 func (f *Font) SetProperty(s1, s2 string) {
-	key:=s1
-	if _, ok := dict[key]; ok {
-       dict[key]=s2
+	key := s1
+	if _, ok := fontDefaults[key]; !ok {
+		return
+	}
+	if f.props == nil {
+		f.props = map[string]string{}
 	}
+	f.props[key] = s2
 }
 
 func (f *Font) GetProperty(key string) string {
-	if val, ok := dict[key]; ok {
-       return val
+	if val, ok := f.props[key]; ok {
+		return val
 	}
-	return ""
+	return fontDefaults[key]
 }
 
 // How to handle document wise properties
@@ -304,3 +342,21 @@ func (c *CaptionStyle) String() string {
 	// user did not specify any caption
 	return ""
 }
+
+// Heading returns the text of the caption.
+func (c *CaptionStyle) Heading() string {
+	return c.heading
+}
+
+// HTML renders the caption as an html caption element. The list
+// entry has no place in html and is ignored.
+func (c *CaptionStyle) HTML() string {
+	if c.heading == "" {
+		return ""
+	}
+	id := ""
+	if c.reflabel != "" {
+		id = ` id="` + htmlEscaper.Replace(c.reflabel) + `"`
+	}
+	return "<caption" + id + ">" + htmlEscaper.Replace(c.heading) + "</caption>"
+}
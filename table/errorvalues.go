@@ -0,0 +1,99 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorPolicy decides what becomes of the error values of the
+// spreadsheet, #DIV/0!, #N/A, #REF! and the like, in the table.
+type ErrorPolicy int
+
+// Policies for the spreadsheet error values.
+const (
+	// ErrorDefault shows #DIV/0! as 0.0, as Clean always did,
+	// and the other error values as they are.
+	ErrorDefault ErrorPolicy = iota
+	// ErrorDash shows the cell as a dash.
+	ErrorDash
+	// ErrorToken shows the error value as it is.
+	ErrorToken
+	// ErrorZero takes the cell for a zero, added to the totals.
+	ErrorZero
+	// ErrorBlank leaves the cell empty.
+	ErrorBlank
+	// ErrorFail stops the rendering at the first error value.
+	ErrorFail
+)
+
+var errorPolicyNames = []string{"default", "dash", "token", "zero", "blank", "fail"}
+
+func (p ErrorPolicy) String() string {
+	if int(p) < len(errorPolicyNames) {
+		return errorPolicyNames[p]
+	}
+	return "unknown"
+}
+
+// ParseErrorPolicy returns the policy of a name:
+// default, dash, token, zero, blank or fail.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	for k, name := range errorPolicyNames {
+		if strings.EqualFold(s, name) {
+			return ErrorPolicy(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown error policy %q, use %s", s, strings.Join(errorPolicyNames, ", "))
+}
+
+// errorValues applies t.ErrorValues to the error cells of a row,
+// selected from the source line, and returns the row. Every error
+// value is reported in t.Diagnostics, with its line and column, so
+// that the spreadsheet gets fixed; under ErrorFail the first one is
+// returned. The row read is left as it is.
+func (t *Table) errorValues(vector []Field, line int) ([]Field, error) {
+	copied := false
+	for k, f := range vector {
+		if f.t != ErrorCell {
+			continue
+		}
+		if !copied {
+			vector = append([]Field(nil), vector...)
+			copied = true
+		}
+		column := k
+		if len(t.selector) > 0 {
+			column = t.selector[k]
+		}
+		msg := strings.TrimSpace(f.Value)
+		if f.Name != "" {
+			msg += " in " + f.Name
+		}
+		err := &RecordError{
+			File:   t.inpath,
+			Line:   line,
+			Column: column,
+			Err:    fmt.Errorf("%w: %s", ErrSpreadsheetError, msg),
+		}
+		switch t.ErrorValues {
+		case ErrorFail:
+			return nil, err
+		case ErrorToken:
+			vector[k].Value = strings.TrimSpace(f.Value)
+		case ErrorZero:
+			vector[k] = NewField(f.Name, "0")
+		case ErrorBlank:
+			vector[k] = NewField(f.Name, "")
+		case ErrorDash:
+			vector[k] = Field{Name: f.Name, Value: "–", t: ErrorCell}
+		default:
+			if strings.TrimSpace(f.Value) == "#DIV/0!" {
+				vector[k] = NewField(f.Name, "0.0")
+			} else {
+				vector[k].Value = strings.TrimSpace(f.Value)
+			}
+		}
+		t.warn(err)
+	}
+	return vector, nil
+}
@@ -0,0 +1,168 @@
+package table
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latexEscapes are the replacements of the characters that
+// LaTeX does not typeset as they are.
+var latexEscapes = map[rune]string{
+	// the ten specials
+	'#':  `\#`,
+	'$':  `\$`,
+	'%':  `\%`,
+	'&':  `\&`,
+	'_':  `\_`,
+	'{':  `\{`,
+	'}':  `\}`,
+	'~':  `\textasciitilde{}`,
+	'^':  `\textasciicircum{}`,
+	'\\': `\textbackslash{}`,
+	// not special, but wrong in the OT1 encoding
+	'<': `\textless{}`,
+	'>': `\textgreater{}`,
+	'|': `\textbar{}`,
+
+	// typographic quotes and dashes
+	'‘':      "`",
+	'’':      "'",
+	'“':      "``",
+	'”':      "''",
+	'«':      `\guillemotleft{}`,
+	'»':      `\guillemotright{}`,
+	'–':      "--",
+	'—':      "---",
+	'…':      `\dots{}`,
+	'\u00a0': "~", // no-break space
+
+	// the symbols met in specifications and cost reports
+	'°':      `\textdegree{}`,
+	'±':      `\textpm{}`,
+	'\u00b5': `\textmu{}`, // micro sign
+	'\u03bc': `\textmu{}`, // greek mu
+	'×':      `\texttimes{}`,
+	'÷':      `\textdiv{}`,
+	'²':      `\textsuperscript{2}`,
+	'³':      `\textsuperscript{3}`,
+	'¹':      `\textsuperscript{1}`,
+	'¼':      `\textonequarter{}`,
+	'½':      `\textonehalf{}`,
+	'¾':      `\textthreequarters{}`,
+	'‰':      `\textperthousand{}`,
+	'€':      `\texteuro{}`,
+	'£':      `\pounds{}`,
+	'¢':      `\textcent{}`,
+	'¥':      `\textyen{}`,
+	'©':      `\textcopyright{}`,
+	'®':      `\textregistered{}`,
+	'™':      `\texttrademark{}`,
+	'§':      `\S{}`,
+	'¶':      `\P{}`,
+	'•':      `\textbullet{}`,
+	'Ø':      `\O{}`,
+	'ø':      `\o{}`,
+	'Ω':      `\ensuremath{\Omega}`,
+	'≤':      `\ensuremath{\leq}`,
+	'≥':      `\ensuremath{\geq}`,
+	'≠':      `\ensuremath{\neq}`,
+	'≈':      `\ensuremath{\approx}`,
+	'√':      `\ensuremath{\surd}`,
+	'\u2212': `\ensuremath{-}`, // minus sign
+}
+
+// EscapeLaTeX escapes the text of a cell for LaTeX. The ten special
+// characters are escaped, the symbols of latexEscapes are replaced by
+// their commands and straight quotes become typographic ones, opening
+// or closing depending on what surrounds them. A double quote after
+// a digit, as in 6" PIPE, is an inch sign. Control characters, line
+// breaks included, become spaces.
+func EscapeLaTeX(s string) string {
+	if !needsEscape(s) {
+		return s
+	}
+	var b strings.Builder
+	rs := []rune(s)
+	open := false // a double quote is open
+	for k, r := range rs {
+		var prev, next rune = ' ', ' '
+		if k > 0 {
+			prev = rs[k-1]
+		}
+		if k+1 < len(rs) {
+			next = rs[k+1]
+		}
+		switch {
+		case r == '"' && open:
+			b.WriteString("''")
+			open = false
+		case r == '"' && unicode.IsDigit(prev):
+			b.WriteString(`\textquotedbl{}`)
+		case r == '"' && opens(prev) && !unicode.IsSpace(next):
+			b.WriteString("``")
+			open = true
+		case r == '"':
+			b.WriteString("''")
+		case r == '\'' && opens(prev) && unicode.IsLetter(next):
+			b.WriteString("`")
+		case unicode.IsControl(r):
+			// line breaks and characters TeX rejects
+			b.WriteRune(' ')
+		default:
+			if e, ok := latexEscapes[r]; ok {
+				b.WriteString(e)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// opens reports whether a quote after r opens a quotation.
+func opens(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("([{", r)
+}
+
+// needsEscape reports whether s has anything EscapeLaTeX replaces.
+func needsEscape(s string) bool {
+	for _, r := range s {
+		if r == '"' || r == '\'' || unicode.IsControl(r) || latexEscapes[r] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RawColumns marks source columns as raw LaTeX: their cells are
+// written as they are, not escaped. The columns are selected as
+// in ColumnsByName.
+//
+//	r.RawColumns("formula", "C")
+func (t *Table) RawColumns(s ...interface{}) {
+	t.rawColumns = append(t.rawColumns, s...)
+}
+
+// texValues returns the LaTeX of the cells of a row: escaped
+// unless their column is raw, and then made safe in safe mode.
+func (t *Table) texValues(fields []Field) []string {
+	cols := t.pickColumns()
+	vector := make([]string, len(fields))
+	for k, f := range fields {
+		if k < len(cols) && cols[k].Raw {
+			vector[k] = t.safeValue(cols[k].Index, f.Value)
+		} else {
+			vector[k] = EscapeLaTeX(f.Value)
+		}
+	}
+	return vector
+}
+
+// escapeAll escapes a row of text.
+func escapeAll(record []string) []string {
+	vector := make([]string, len(record))
+	for k, v := range record {
+		vector[k] = EscapeLaTeX(v)
+	}
+	return vector
+}
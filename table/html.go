@@ -0,0 +1,259 @@
+package table
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"ml/table/caption"
+	"strings"
+)
+
+// HTMLRenderer renders a table as semantic html: a table element
+// with its caption, the head in a thead and every section in a tbody
+// of its own. Spanning labels use colspan and the look is left to
+// a stylesheet, generated from the table configuration if asked.
+//
+//	r.Renderer = table.NewHTMLRenderer()
+//	err := r.RenderSections(w, rd, prop)
+type HTMLRenderer struct {
+	// Stylesheet writes a style element before the table.
+	Stylesheet bool
+	// Class is the class of the table element.
+	Class string
+
+	t     *Table
+	w     *bufio.Writer
+	ncols int
+	// rows counts the detail rows, for the stripes
+	rows int
+	// classes of the next row, set by rules and page breaks
+	next []string
+	// filled is set once the current tbody has a row
+	filled bool
+}
+
+// NewHTMLRenderer creates a renderer that includes its stylesheet.
+func NewHTMLRenderer() *HTMLRenderer {
+	return &HTMLRenderer{Stylesheet: true, Class: "phd-table"}
+}
+
+// escape returns the html text of a cell.
+func escape(s string) string {
+	return html.EscapeString(strings.TrimSpace(s))
+}
+
+// cssColor returns c if it is a css colour, or else def.
+func cssColor(c, def string) string {
+	if checkColor(c) == nil {
+		return c
+	}
+	return def
+}
+
+// Style returns the stylesheet of the table. The stripes use the
+// colours of t.Stripe when they are css colours.
+func (h *HTMLRenderer) Style(t *Table) string {
+	var buf bytes.Buffer
+	class := "table." + h.Class
+	fmt.Fprintf(&buf, "%s {\n  border-collapse: collapse;\n  border-top: 2px solid black;\n  border-bottom: 2px solid black;\n}\n", class)
+	fmt.Fprintf(&buf, "%s th, %s td {\n  padding: 0.2em 0.6em;\n  text-align: left;\n  vertical-align: top;\n}\n", class, class)
+	fmt.Fprintf(&buf, "%s thead th {\n  border-bottom: 1px solid black;\n}\n", class)
+	fmt.Fprintf(&buf, "%s td.num {\n  text-align: right;\n  font-variant-numeric: tabular-nums;\n}\n", class)
+	fmt.Fprintf(&buf, "%s td.neg {\n  color: red;\n}\n", class)
+	fmt.Fprintf(&buf, "%s tr.section th {\n  font-weight: bold;\n  border-bottom: 1.5px solid black;\n}\n", class)
+	fmt.Fprintf(&buf, "%s tr.subtotal, %s tr.total {\n  font-weight: bold;\n  border-top: 1.5px solid black;\n  border-bottom: 1.5px solid black;\n}\n", class, class)
+	fmt.Fprintf(&buf, "%s tr.rule {\n  border-top: 1px solid black;\n}\n", class)
+	fmt.Fprintf(&buf, "%s tr.blank td {\n  border-top: 1px solid gray;\n}\n", class)
+	fmt.Fprintf(&buf, "%s tr.page-break {\n  break-before: page;\n}\n", class)
+	fmt.Fprintf(&buf, "%s td.mismatch {\n  background-color: %s;\n}\n", class, cssColor(t.Audit.Highlight, "yellow"))
+	if t.Stripe.activate {
+		fmt.Fprintf(&buf, "%s tr.odd {\n  background-color: %s;\n}\n", class, cssColor(t.Stripe.OddColor, "white"))
+		fmt.Fprintf(&buf, "%s tr.even {\n  background-color: %s;\n}\n", class, cssColor(t.Stripe.EvenColor, "whitesmoke"))
+	}
+	caption.HtmlRenderer(&buf, nil).AddToPreamble(&buf, nil)
+	return buf.String()
+}
+
+// tr opens a row with the classes given and those
+// left by a rule or a page break.
+func (h *HTMLRenderer) tr(classes ...string) {
+	classes = append(classes, h.next...)
+	h.next = nil
+	h.filled = true
+	if len(classes) == 0 {
+		fmt.Fprint(h.w, "<tr>")
+		return
+	}
+	fmt.Fprintf(h.w, `<tr class="%s">`, strings.Join(classes, " "))
+}
+
+// td writes a cell. Numbers are aligned to the right and
+// negative numbers shown in red.
+func (h *HTMLRenderer) td(f Field, colspan int) {
+	var classes []string
+	if f.num != nil {
+		classes = append(classes, "num")
+		if f.num.Sign() < 0 {
+			classes = append(classes, "neg")
+		}
+	}
+	if f.mark {
+		classes = append(classes, "mismatch")
+	}
+	fmt.Fprint(h.w, "<td")
+	if colspan > 1 {
+		fmt.Fprintf(h.w, ` colspan="%d"`, colspan)
+	}
+	if len(classes) > 0 {
+		fmt.Fprintf(h.w, ` class="%s"`, strings.Join(classes, " "))
+	}
+	fmt.Fprintf(h.w, ">%s</td>", escape(f.Value))
+}
+
+// Begin writes the stylesheet, the caption and the head. The head
+// is the manual header, if any, or else the header rows of the source.
+// LaTeX Labels have no meaning in html and are ignored.
+func (h *HTMLRenderer) Begin(t *Table, w io.Writer) error {
+	h.t = t
+	h.w = bufio.NewWriter(w)
+	h.ncols = len(t.pickColumns())
+	h.rows = 0
+	h.next = nil
+	h.filled = false
+	if h.Class == "" {
+		h.Class = "phd-table"
+	}
+
+	if h.Stylesheet {
+		fmt.Fprintf(h.w, "<style>\n%s</style>\n", h.Style(t))
+	}
+	fmt.Fprintf(h.w, "<table class=\"%s\">\n", h.Class)
+	if c := t.CaptionStyle.HTML(); c != "" {
+		fmt.Fprintln(h.w, c)
+	}
+
+	head := t.Header.M
+	if len(head) == 0 && t.header {
+		for n, record := range t.headRows {
+			vector, err := t.headVector(record, n)
+			if err != nil {
+				return err
+			}
+			head = append(head, vector)
+		}
+	}
+	if len(head) > 0 {
+		fmt.Fprintln(h.w, "<thead>")
+		for _, row := range head {
+			fmt.Fprint(h.w, "<tr>")
+			for _, v := range row {
+				fmt.Fprintf(h.w, `<th scope="col">%s</th>`, escape(v))
+			}
+			fmt.Fprintln(h.w, "</tr>")
+		}
+		fmt.Fprintln(h.w, "</thead>")
+	}
+	fmt.Fprintln(h.w, "<tbody>")
+	return nil
+}
+
+// Row writes a detail row, striped if t.Stripe is active.
+func (h *HTMLRenderer) Row(fields []Field) {
+	h.rows++
+	var classes []string
+	if h.t.Stripe.activate {
+		if h.rows%2 == 0 {
+			classes = append(classes, "even")
+		} else {
+			classes = append(classes, "odd")
+		}
+	}
+	h.tr(classes...)
+	for _, f := range fields {
+		h.td(f, 1)
+	}
+	fmt.Fprintln(h.w, "</tr>")
+}
+
+// Span writes the label of the rule spanning its columns. The
+// LaTeX Format and Label of the rule are not used.
+func (h *HTMLRenderer) Span(rule *Rule, fields []Field) {
+	if len(fields) == 0 {
+		return
+	}
+	start := rule.Start
+	if start >= len(fields) {
+		start = len(fields) - 1
+	}
+	span := rule.Span
+	if span < 1 {
+		span = 1
+	}
+	if start+span > len(fields) {
+		span = len(fields) - start
+	}
+
+	if rule.Action == SubtotalRow {
+		h.tr("subtotal")
+	} else {
+		h.tr("span")
+	}
+	for _, f := range fields[:start] {
+		h.td(f, 1)
+	}
+	h.td(Field{Value: fields[start].Value, mark: fields[start].mark}, span)
+	for _, f := range fields[start+span:] {
+		h.td(f, 1)
+	}
+	fmt.Fprintln(h.w, "</tr>")
+}
+
+// Section opens a new tbody headed by the title.
+func (h *HTMLRenderer) Section(title, width string) {
+	if h.filled {
+		fmt.Fprintln(h.w, "</tbody>")
+		fmt.Fprintln(h.w, "<tbody>")
+	}
+	h.tr("section")
+	fmt.Fprintf(h.w, `<th colspan="%d" scope="rowgroup">%s</th></tr>`+"\n", h.ncols, escape(title))
+}
+
+// Rule draws a border above the next row, the width is left
+// to the stylesheet.
+func (h *HTMLRenderer) Rule(width string) {
+	h.next = append(h.next, "rule")
+}
+
+// PageBreak breaks the page before the next row when printed.
+func (h *HTMLRenderer) PageBreak() {
+	h.next = append(h.next, "page-break")
+}
+
+// Blank writes an empty row.
+func (h *HTMLRenderer) Blank() {
+	h.tr("blank")
+	fmt.Fprintf(h.w, `<td colspan="%d"></td></tr>`+"\n", h.ncols)
+}
+
+// Total writes a total computed by the package.
+func (h *HTMLRenderer) Total(label string, at, span int, fields []Field) {
+	h.tr("total")
+	for k := 0; k < len(fields); k++ {
+		if k == at && span > 0 {
+			fmt.Fprintf(h.w, `<th colspan="%d" scope="row">%s</th>`, span, escape(label))
+			k += span - 1
+			continue
+		}
+		h.td(fields[k], 1)
+	}
+	fmt.Fprintln(h.w, "</tr>")
+}
+
+// End closes the table and flushes the output.
+func (h *HTMLRenderer) End() error {
+	fmt.Fprintln(h.w, "</tbody>")
+	fmt.Fprintln(h.w, "</table>")
+	return h.w.Flush()
+}
@@ -0,0 +1,386 @@
+package table
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// RecordReader reads the records of a source one at a time.
+type RecordReader interface {
+	// Read returns the next record, or io.EOF after the last.
+	// A *RecordError reports a record that cannot be read, and
+	// the reading goes on with the next one.
+	Read() ([]string, error)
+	// Line returns the line in the source where
+	// the record last read starts.
+	Line() int
+}
+
+// Input opens a source as a RecordReader. The table reads its
+// source with t.Input, a csv file if it is nil.
+type Input interface {
+	Open(r io.Reader) RecordReader
+}
+
+// LineOptions are the settings shared by the inputs.
+type LineOptions struct {
+	// Comment starts the lines to skip, such as "#"
+	// or "%". No line is a comment if it is empty.
+	Comment string
+	// Trim trims the padding around every field of a delimited
+	// input. Whitespace and fixed width fields are always trimmed.
+	Trim bool
+	// FillMerged copies the value of a merged region of a spreadsheet
+	// to all of its cells, so that a category merged down the rows it
+	// covers is repeated on every row. Otherwise they are empty.
+	FillMerged bool
+}
+
+// NewInput returns the input of a format: "csv", "tsv", "whitespace",
+// "fixed" with the widths of the columns detected, "fixed:8,20,40" with
+// them declared, "auto" with the delimiter sniffed, "xlsx" for the first
+// sheet of a workbook, "xlsx:Costs" or "xlsx:Costs!A3:F40" for a sheet
+// and a range, "ods" and "ods:Costs!A3:F40" likewise for OpenDocument
+// spreadsheets, "json" for json objects and "jsonl" or "ndjson" for
+// JSON Lines, "json:items" with the array items exploded into rows,
+// or a single character that separates the fields.
+func NewInput(format string, opt LineOptions) (Input, error) {
+	switch f := strings.ToLower(format); {
+	case f == "" || f == "csv":
+		return &Delimited{Comma: ',', LineOptions: opt}, nil
+	case f == "tsv" || f == "tab" || f == `\t`:
+		return &Delimited{Comma: '\t', LineOptions: opt}, nil
+	case f == "whitespace" || f == "space":
+		return &Whitespace{LineOptions: opt}, nil
+	case f == "xlsx" || strings.HasPrefix(f, "xlsx:"):
+		// the case of the sheet name is kept
+		return &XLSX{SheetOptions: parseSheetFormat(strings.TrimPrefix(format[len("xlsx"):], ":")), LineOptions: opt}, nil
+	case f == "ods" || strings.HasPrefix(f, "ods:"):
+		return &ODS{SheetOptions: parseSheetFormat(strings.TrimPrefix(format[len("ods"):], ":")), LineOptions: opt}, nil
+	case f == "json" || strings.HasPrefix(f, "json:"):
+		// the case of the path is kept
+		return &JSON{Explode: strings.TrimPrefix(format[len("json"):], ":"), LineOptions: opt}, nil
+	case f == "jsonl" || f == "ndjson" || strings.HasPrefix(f, "jsonl:") || strings.HasPrefix(f, "ndjson:"):
+		explode := ""
+		if k := strings.IndexByte(format, ':'); k >= 0 {
+			explode = format[k+1:]
+		}
+		return &JSON{Explode: explode, Lines: true, LineOptions: opt}, nil
+	case f == "auto":
+		return &Auto{LineOptions: opt}, nil
+	case f == "fixed":
+		return &FixedWidth{LineOptions: opt}, nil
+	case strings.HasPrefix(f, "fixed:"):
+		var widths []int
+		for _, s := range strings.Split(f[len("fixed:"):], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("fixed width input: %q is not a width", s)
+			}
+			widths = append(widths, n)
+		}
+		return &FixedWidth{Widths: widths, LineOptions: opt}, nil
+	case utf8.RuneCountInString(format) == 1:
+		comma, _ := utf8.DecodeRuneInString(format)
+		return &Delimited{Comma: comma, LineOptions: opt}, nil
+	}
+	return nil, fmt.Errorf("unknown input %q, use csv, tsv, whitespace, fixed, fixed:widths, auto, xlsx:sheet!range, ods:sheet!range, json:explode, jsonl:explode or a delimiter", format)
+}
+
+// input returns the input of the table, csv if none is set.
+func (t *Table) input() Input {
+	if a, ok := t.Input.(*Auto); ok && t.Sniffed.Delimiter != 0 {
+		// sniffed by decode, past the lines skipped
+		return t.Sniffed.Input(a.LineOptions)
+	}
+	if t.Input != nil {
+		return t.Input
+	}
+	return &Delimited{Comma: ','}
+}
+
+// Delimited reads fields separated by a single character: a comma
+// for csv, a tab for tsv, or a semicolon as excel exports them in
+// some locales. Fields can be quoted as in csv, with double quotes
+// or the ascii character Quote.
+type Delimited struct {
+	Comma rune
+	Quote rune
+	LineOptions
+}
+
+// Open returns a reader of the delimited records of r.
+func (d *Delimited) Open(r io.Reader) RecordReader {
+	quote := byte('"')
+	if d.Quote > 0 && d.Quote < utf8.RuneSelf {
+		quote = byte(d.Quote)
+	}
+	if quote != '"' {
+		r = &swapper{r: r, a: quote, b: '"'}
+	}
+	rd := csv.NewReader(r)
+	rd.Comma = d.Comma
+	if d.Comma == 0 {
+		rd.Comma = ','
+	}
+	if c, n := utf8.DecodeRuneInString(d.Comment); n == len(d.Comment) && n > 0 {
+		rd.Comment = c
+	}
+	rd.LazyQuotes = true
+	// allows missing, short records are reported
+	// when the columns are selected
+	rd.FieldsPerRecord = -1
+	return &delimitedReader{rd, d.Trim, quote}
+}
+
+type delimitedReader struct {
+	*csv.Reader
+	trim  bool
+	quote byte
+}
+
+func (d *delimitedReader) Read() ([]string, error) {
+	record, err := d.Reader.Read()
+	for k, v := range record {
+		if d.quote != '"' {
+			v = swap(v, d.quote, '"')
+		}
+		if d.trim {
+			v = strings.TrimSpace(v)
+		}
+		record[k] = v
+	}
+	return record, err
+}
+
+// swapper swaps two ascii characters of a source, for encoding/csv
+// to read fields quoted with another character than double quotes.
+type swapper struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (s *swapper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for k, c := range p[:n] {
+		if c == s.a {
+			p[k] = s.b
+		} else if c == s.b {
+			p[k] = s.a
+		}
+	}
+	return n, err
+}
+
+// swap swaps back the characters of a field.
+func swap(v string, a, b byte) string {
+	if strings.IndexByte(v, a) < 0 && strings.IndexByte(v, b) < 0 {
+		return v
+	}
+	p := []byte(v)
+	for k, c := range p {
+		if c == a {
+			p[k] = b
+		} else if c == b {
+			p[k] = a
+		}
+	}
+	return string(p)
+}
+
+func (d *delimitedReader) Line() int {
+	line, _ := d.FieldPos(0)
+	return line
+}
+
+// lineReader reads the lines of a source that are
+// neither empty nor comments. Lines have no limit of length.
+type lineReader struct {
+	br      *bufio.Reader
+	comment string
+	line    int
+}
+
+func newLineReader(r io.Reader, comment string) *lineReader {
+	return &lineReader{br: bufio.NewReader(r), comment: comment}
+}
+
+// next returns the next line, without its end.
+func (l *lineReader) next() (string, error) {
+	for {
+		s, err := l.br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if s == "" && err == io.EOF {
+			return "", io.EOF
+		}
+		l.line++
+		s = strings.TrimRight(s, "\r\n")
+		trimmed := strings.TrimSpace(s)
+		if trimmed == "" || l.comment != "" && strings.HasPrefix(trimmed, l.comment) {
+			continue
+		}
+		return s, nil
+	}
+}
+
+func (l *lineReader) Line() int {
+	return l.line
+}
+
+// Whitespace reads fields separated by runs of spaces and tabs,
+// as in the data files of pgfplotstable and gnuplot. Empty
+// lines are skipped.
+type Whitespace struct {
+	LineOptions
+}
+
+// Open returns a reader of the whitespace separated records of r.
+func (ws *Whitespace) Open(r io.Reader) RecordReader {
+	return &whitespaceReader{newLineReader(r, ws.Comment)}
+}
+
+type whitespaceReader struct {
+	*lineReader
+}
+
+func (w *whitespaceReader) Read() ([]string, error) {
+	s, err := w.next()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(s), nil
+}
+
+// skipper is implemented by the readers that skip the
+// first lines of the source on their own.
+type skipper interface {
+	Skip(n int) error
+}
+
+// fixedSample is the number of lines FixedWidth
+// examines to detect the columns.
+const fixedSample = 100
+
+// FixedWidth reads columns of fixed widths, counted in characters,
+// as printed by mainframes and older ERP reports. If Widths is nil
+// the columns are detected from the first lines after the ones the
+// table skips: they are separated by the positions that are blank on
+// all of them. The last column runs to the end of the line.
+type FixedWidth struct {
+	Widths []int
+	LineOptions
+}
+
+// Open returns a reader of the fixed width records of r.
+func (fw *FixedWidth) Open(r io.Reader) RecordReader {
+	f := &fixedReader{lineReader: newLineReader(r, fw.Comment)}
+	start := 0
+	for _, w := range fw.Widths {
+		f.starts = append(f.starts, start)
+		start += w
+	}
+	return f
+}
+
+type fixedReader struct {
+	*lineReader
+	starts []int
+	// lines read to detect the columns, with their line numbers
+	sample  []string
+	lines   []int
+	current int
+}
+
+// detect reads the sample and finds where the columns start.
+func (f *fixedReader) detect() error {
+	var used []int // non blank characters at every position
+	for len(f.sample) < fixedSample {
+		s, err := f.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		f.sample = append(f.sample, s)
+		f.lines = append(f.lines, f.line)
+		for k, r := range []rune(s) {
+			if k == len(used) {
+				used = append(used, 0)
+			}
+			if r != ' ' && r != '\t' {
+				used[k]++
+			}
+		}
+	}
+	inColumn := false
+	for k, n := range used {
+		if n > 0 && !inColumn {
+			f.starts = append(f.starts, k)
+		}
+		inColumn = n > 0
+	}
+	if len(f.starts) == 0 {
+		f.starts = []int{0}
+	}
+	f.starts[0] = 0
+	return nil
+}
+
+func (f *fixedReader) Read() ([]string, error) {
+	if f.starts == nil {
+		if err := f.detect(); err != nil {
+			return nil, err
+		}
+	}
+	var s string
+	if len(f.sample) > 0 {
+		s, f.current = f.sample[0], f.lines[0]
+		f.sample, f.lines = f.sample[1:], f.lines[1:]
+	} else {
+		var err error
+		if s, err = f.next(); err != nil {
+			return nil, err
+		}
+		f.current = f.line
+	}
+
+	rs := []rune(s)
+	record := make([]string, len(f.starts))
+	for k, start := range f.starts {
+		end := len(rs)
+		if k+1 < len(f.starts) && f.starts[k+1] < end {
+			end = f.starts[k+1]
+		}
+		if start < end {
+			record[k] = strings.TrimSpace(string(rs[start:end]))
+		}
+	}
+	return record, nil
+}
+
+// Skip skips n lines before the columns are detected,
+// so that titles do not get in the way.
+func (f *fixedReader) Skip(n int) error {
+	for ; n > 0 && len(f.sample) == 0; n-- {
+		if _, err := f.next(); err != nil {
+			return err
+		}
+	}
+	for ; n > 0; n-- {
+		if _, err := f.Read(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fixedReader) Line() int {
+	return f.current
+}
@@ -0,0 +1,133 @@
+package table
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll returns the records of an input and their lines.
+func readAll(t *testing.T, in Input, src string) ([][]string, []int) {
+	rd := in.Open(strings.NewReader(src))
+	var records [][]string
+	var lines []int
+	for {
+		record, err := rd.Read()
+		if err == io.EOF {
+			return records, lines
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+		lines = append(lines, rd.Line())
+	}
+}
+
+func TestFixedWidth(t *testing.T) {
+	long := strings.Repeat("x", 3<<20)
+	tests := []struct {
+		name    string
+		format  string
+		src     string
+		records [][]string
+		lines   []int
+	}{
+		{"detected", "fixed",
+			"CODE  ITEM           QTY\n" +
+				"A1    Pipe sleeve  12345\n" +
+				"B22   Steel bolt       7\n",
+			[][]string{{"CODE", "ITEM", "QTY"}, {"A1", "Pipe sleeve", "12345"}, {"B22", "Steel bolt", "7"}},
+			[]int{1, 2, 3}},
+		{"indented", "fixed",
+			"  A1  Pipe\n" +
+				"  B2  Bolt\n",
+			[][]string{{"A1", "Pipe"}, {"B2", "Bolt"}},
+			[]int{1, 2}},
+		{"ragged", "fixed",
+			"A1  Pipe  2\n" +
+				"B2  Bolt\n" +
+				"C3\n",
+			[][]string{{"A1", "Pipe", "2"}, {"B2", "Bolt", ""}, {"C3", "", ""}},
+			[]int{1, 2, 3}},
+		{"runes", "fixed",
+			"€12  Ürün\n" +
+				"$7   Boru\n",
+			[][]string{{"€12", "Ürün"}, {"$7", "Boru"}},
+			[]int{1, 2}},
+		{"comments and blank lines", "fixed",
+			"# stock\n" +
+				"A1  Pipe\n" +
+				"\n" +
+				"B2  Bolt\n",
+			[][]string{{"A1", "Pipe"}, {"B2", "Bolt"}},
+			[]int{2, 4}},
+		{"declared", "fixed:2,5,3",
+			"A1Pipe 12\n" +
+				"B2Bolt  7\n",
+			[][]string{{"A1", "Pipe", "12"}, {"B2", "Bolt", "7"}},
+			[]int{1, 2}},
+		{"declared to the end of the line", "fixed:2,5",
+			"A1Pipe 12\n",
+			[][]string{{"A1", "Pipe 12"}},
+			[]int{1}},
+		{"long line", "fixed",
+			"A1  " + long + "\n" +
+				"B2  Bolt\n",
+			[][]string{{"A1", long}, {"B2", "Bolt"}},
+			[]int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := NewInput(tt.format, LineOptions{Comment: "#"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, lines := readAll(t, in, tt.src)
+			if fmt.Sprint(records) != fmt.Sprint(tt.records) {
+				t.Errorf("records %q, want %q", records, tt.records)
+			}
+			if fmt.Sprint(lines) != fmt.Sprint(tt.lines) {
+				t.Errorf("lines %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+// TestFixedWidthSkip checks that the lines skipped, a title above the
+// columns, are left out of the detection.
+func TestFixedWidthSkip(t *testing.T) {
+	tb := New()
+	tb.Input = &FixedWidth{}
+	tb.SkipN = 2
+	tb.HasHeader = true
+	src := "STOCK AT THE DOHA YARD, MARCH 2023\n" +
+		"==================================\n" +
+		"CODE  ITEM           QTY\n" +
+		"A1    Pipe sleeve  12345\n" +
+		"B22   Steel bolt       7\n"
+	if err := tb.Load(strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range tb.ColumnInfo() {
+		names = append(names, c.Name)
+	}
+	if want := []string{"CODE", "ITEM", "QTY"}; fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("columns %q, want %q", names, want)
+	}
+	if tb.Rows() != 2 || Values(tb.Row(1))[1] != "Steel bolt" {
+		t.Errorf("rows %d, want the two items", tb.Rows())
+	}
+	if c := tb.ColumnInfo()[2]; c.Type != IntegerCell {
+		t.Errorf("QTY is %v, want integers", c.Type)
+	}
+}
+
+func TestNewInputFixed(t *testing.T) {
+	for _, format := range []string{"fixed:", "fixed:8,x", "fixed:8,0", "fixed:-2"} {
+		if _, err := NewInput(format, LineOptions{}); err == nil {
+			t.Errorf("NewInput(%q) accepts the widths", format)
+		}
+	}
+}
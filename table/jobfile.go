@@ -0,0 +1,494 @@
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JobFile is a declarative description of one or many tables, for
+// those who would rather not write Go. It is read from json:
+//
+//	{
+//	  "properties": {"type": "longtable", "palette": "black tulip"},
+//	  "tables": [{
+//	    "input": "j56.csv",
+//	    "output": "materials.tex",
+//	    "sections": true,
+//	    "skip": 4,
+//	    "columns": [0, 1, "9", "8", "11-15"],
+//	    "header": [["SR", "CAT", "CODE"], ["", "", ""]],
+//	    "triggers": [{"column": 1, "match": "prefix", "words": ["SUBTOTAL"], "action": "subtotal"}],
+//	    "section_titles": {"file": "sections.json", "fallback": "SECTION UNKNOWN"},
+//	    "caption": "Material Costs",
+//	    "label": "tbl:materials",
+//	    "properties": {"font-size": "footnotesize"}
+//	  }]
+//	}
+//
+// The properties at the top are shared by all the tables, those of a
+// table win. Relative paths are relative to the job file.
+type JobFile struct {
+	Properties map[string]string `json:"properties"`
+	Tables     []TableSpec       `json:"tables"`
+}
+
+// TableSpec describes a table of a job file.
+type TableSpec struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// Format is latex, the default, html, markdown or text.
+	Format string `json:"format"`
+	// Sections renders as SectionCSV, otherwise as ReadCSV.
+	Sections  bool `json:"sections"`
+	Summation bool `json:"summation"`
+	Skip      int  `json:"skip"`
+	// Reader is the input, as NewInput: csv, tsv, whitespace,
+	// fixed, fixed:8,20,40, auto, xlsx, ods, json, jsonl or a
+	// delimiter. Comment starts the lines to skip and Trim
+	// trims the delimited fields.
+	// Encoding is the encoding of the input, sniffed if empty.
+	// FillMerged repeats the merged cells of a workbook.
+	Reader     string `json:"reader"`
+	Comment    string `json:"comment"`
+	Trim       bool   `json:"trim"`
+	Encoding   string `json:"encoding"`
+	FillMerged bool   `json:"fill_merged"`
+	// HeaderLines is the number of header rows in the csv.
+	// NoHeader reads them as data, even if a header was sniffed.
+	HeaderLines int  `json:"header_lines"`
+	NoHeader    bool `json:"no_header"`
+	// Header is the manual header, as Header.M.
+	Header [][]string `json:"header"`
+	// Columns are indices, names, ranges and patterns, as
+	// accepted by ColumnsByName.
+	Columns []interface{} `json:"columns"`
+	// RawColumns are the columns of raw LaTeX, not escaped.
+	// Safe neutralises them but for SafeCommands.
+	RawColumns   []interface{} `json:"raw_columns"`
+	Safe         bool          `json:"safe"`
+	SafeCommands []string      `json:"safe_commands"`
+	// ErrorValues is default, dash, token, zero, blank or fail.
+	ErrorValues   string            `json:"error_values"`
+	Triggers      []RuleSpec        `json:"triggers"`
+	SectionTitles *SectionTitleSpec `json:"section_titles"`
+	EmptyToLine   bool              `json:"empty_to_line"`
+	Caption       string            `json:"caption"`
+	// ListEntry is the caption in the list of tables.
+	ListEntry  string            `json:"list_entry"`
+	Label      string            `json:"label"`
+	Float      string            `json:"float"`
+	Placement  string            `json:"placement"`
+	Landscape  bool              `json:"landscape"`
+	Stripes    bool              `json:"stripes"`
+	Properties map[string]string `json:"properties"`
+}
+
+// RuleSpec describes a trigger Rule. Match is prefix, contains,
+// exact, regex or bold and Action subtotal, section, multicolumn,
+// midrule, pagebreak or skip. The layout of the label defaults as in NewRule.
+type RuleSpec struct {
+	Column int      `json:"column"`
+	Match  string   `json:"match"`
+	Words  []string `json:"words"`
+	Action string   `json:"action"`
+	Start  *int     `json:"start"`
+	Span   *int     `json:"span"`
+	Format string   `json:"format"`
+	Label  string   `json:"label"`
+	Width  string   `json:"width"`
+	// MinCells limits the rule to the records of at
+	// least that many cells.
+	MinCells int `json:"min_cells"`
+}
+
+// SectionTitleSpec describes the section titles, read from
+// File or given as Titles.
+type SectionTitleSpec struct {
+	File     string            `json:"file"`
+	Titles   map[string]string `json:"titles"`
+	Column   *int              `json:"column"`
+	Fallback string            `json:"fallback"`
+}
+
+var actions = map[string]Action{
+	"subtotal":    SubtotalRow,
+	"section":     SectionRow,
+	"multicolumn": MulticolumnRow,
+	"midrule":     MidruleRow,
+	"pagebreak":   PageBreakRow,
+	"skip":        SkipRow,
+}
+
+// JobFileError lists the problems found in a job file.
+type JobFileError struct {
+	File     string
+	Problems []string
+}
+
+func (e *JobFileError) Error() string {
+	return e.File + ": " + strings.Join(e.Problems, "\n"+e.File+": ")
+}
+
+// LoadJobs reads a job file and builds its jobs, ready for Batch.
+func LoadJobs(path string) ([]*Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadJobs(f, path)
+}
+
+// RunJobFile loads a job file and renders its tables with Batch.
+// It returns the error of every table, or the error of the file.
+func RunJobFile(ctx context.Context, path string, workers int) ([]error, error) {
+	jobs, err := LoadJobs(path)
+	if err != nil {
+		return nil, err
+	}
+	return Batch(ctx, workers, jobs...), nil
+}
+
+// ReadJobs reads a job file from r. The name is used in the errors
+// and relative paths are resolved against its directory. Unknown keys
+// are reported with the closest known one.
+func ReadJobs(r io.Reader, name string) ([]*Job, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, &JobFileError{File: name, Problems: []string{err.Error()}}
+	}
+	var problems []string
+	checkKeys("", raw, reflect.TypeOf(JobFile{}), &problems)
+	if len(problems) > 0 {
+		return nil, &JobFileError{File: name, Problems: problems}
+	}
+
+	var jf JobFile
+	if err := json.Unmarshal(data, &jf); err != nil {
+		return nil, &JobFileError{File: name, Problems: []string{err.Error()}}
+	}
+	if len(jf.Tables) == 0 {
+		return nil, &JobFileError{File: name, Problems: []string{"no tables"}}
+	}
+
+	dir := filepath.Dir(name)
+	var jobs []*Job
+	for k, spec := range jf.Tables {
+		job, err := spec.Job(dir, jf.Properties)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("tables[%d]: %v", k, err))
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(problems) > 0 {
+		return nil, &JobFileError{File: name, Problems: problems}
+	}
+	return jobs, nil
+}
+
+// jsonKeys returns the fields of a struct type by their json key.
+func jsonKeys(t reflect.Type) map[string]reflect.StructField {
+	keys := map[string]reflect.StructField{}
+	for k := 0; k < t.NumField(); k++ {
+		f := t.Field(k)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = f
+		}
+	}
+	return keys
+}
+
+// checkKeys walks a decoded json value along the type it is to be
+// decoded into, and reports the keys that have no field.
+func checkKeys(path string, v interface{}, t reflect.Type, problems *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		keys := jsonKeys(t)
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			at := name
+			if path != "" {
+				at = path + "." + name
+			}
+			f, ok := keys[name]
+			if !ok {
+				*problems = append(*problems, unknownKey(at, name, keys))
+				continue
+			}
+			checkKeys(at, obj[name], f.Type, problems)
+		}
+	case reflect.Slice:
+		list, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for k, e := range list {
+			checkKeys(fmt.Sprintf("%s[%d]", path, k), e, t.Elem(), problems)
+		}
+	}
+}
+
+// unknownKey describes an unknown key, suggesting the closest one.
+func unknownKey(at, name string, keys map[string]reflect.StructField) string {
+	known := make([]string, 0, len(keys))
+	for key := range keys {
+		known = append(known, key)
+	}
+	sort.Strings(known)
+	best, dist := "", 3
+	for _, key := range known {
+		if d := editDistance(strings.ToLower(name), key); d < dist {
+			best, dist = key, d
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("unknown key %q, did you mean %q?", at, best)
+	}
+	return fmt.Sprintf("unknown key %q, the keys are %s", at, strings.Join(known, ", "))
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// resolve returns path relative to dir, unless it is absolute.
+func resolve(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Job builds the job described by the spec. Relative paths are
+// resolved against dir and defaults are the shared properties.
+func (s TableSpec) Job(dir string, defaults map[string]string) (*Job, error) {
+	if s.Input == "" {
+		return nil, fmt.Errorf("missing input")
+	}
+	if s.Output == "" {
+		return nil, fmt.Errorf("missing output")
+	}
+
+	t := New()
+	rd, err := NewRenderer(s.Format)
+	if err != nil {
+		return nil, fmt.Errorf("format: %v", err)
+	}
+	if s.Format != "" {
+		t.Renderer = rd
+	}
+	if t.Input, err = NewInput(s.Reader, LineOptions{Comment: s.Comment, Trim: s.Trim, FillMerged: s.FillMerged}); err != nil {
+		return nil, fmt.Errorf("reader: %v", err)
+	}
+	t.Encoding = s.Encoding
+	t.SkipN = s.Skip
+	if s.HeaderLines > 0 {
+		t.HasHeader = true
+		t.HeaderLines = s.HeaderLines
+	}
+	if s.NoHeader {
+		t.HeaderMode = HeaderNo
+	}
+	t.Header.M = s.Header
+	t.HasSections = s.Sections
+	t.EmptyToLine = s.EmptyToLine
+	t.FloatStart = s.Float
+	t.FloatSpecifier = s.Placement
+	t.Landscape = s.Landscape
+	if s.Stripes {
+		t.Stripe.Activate()
+	}
+
+	if len(s.Columns) > 0 {
+		columns, err := selection("columns", s.Columns)
+		if err != nil {
+			return nil, err
+		}
+		t.ColumnsByName(columns...)
+	}
+	if len(s.RawColumns) > 0 {
+		columns, err := selection("raw_columns", s.RawColumns)
+		if err != nil {
+			return nil, err
+		}
+		t.RawColumns(columns...)
+	}
+	t.Safe = s.Safe
+	t.SafeCommands = s.SafeCommands
+	if s.ErrorValues != "" {
+		if t.ErrorValues, err = ParseErrorPolicy(s.ErrorValues); err != nil {
+			return nil, fmt.Errorf("error_values: %v", err)
+		}
+	}
+
+	for k, rs := range s.Triggers {
+		rule, err := rs.rule()
+		if err != nil {
+			return nil, fmt.Errorf("triggers[%d]: %v", k, err)
+		}
+		t.AddRule(rule)
+	}
+
+	if st := s.SectionTitles; st != nil {
+		titles := NewSectionTitles(st.Titles)
+		if st.File != "" {
+			if titles, err = LoadSectionTitles(resolve(dir, st.File)); err != nil {
+				return nil, fmt.Errorf("section_titles: %v", err)
+			}
+			for code, title := range st.Titles {
+				titles.Titles[code] = title
+			}
+		}
+		if st.Column != nil {
+			titles.Column = *st.Column
+		}
+		titles.Fallback = st.Fallback
+		t.SectionTitles = titles
+	}
+
+	switch {
+	case s.ListEntry != "":
+		t.Caption(s.ListEntry, s.Caption)
+	case s.Caption != "":
+		t.Caption(s.Caption)
+	}
+	if s.Label != "" {
+		t.RefLabel(s.Label)
+	}
+
+	prop := map[string]string{}
+	for k, v := range defaults {
+		prop[k] = v
+	}
+	for k, v := range s.Properties {
+		prop[k] = v
+	}
+
+	// the section titles may come from a file, hash what was read
+	config, err := json.Marshal(struct {
+		Spec   TableSpec
+		Titles *SectionTitles
+	}{s, t.SectionTitles})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		Table:     t,
+		Input:     resolve(dir, s.Input),
+		Output:    resolve(dir, s.Output),
+		Sections:  s.Sections,
+		Summation: s.Summation,
+		Prop:      prop,
+		Config:    hashBytes(config),
+	}, nil
+}
+
+// selection converts the columns of a spec, json numbers
+// and strings, to the indices and names of ColumnsByName.
+func selection(key string, s []interface{}) ([]interface{}, error) {
+	columns := make([]interface{}, len(s))
+	for k, c := range s {
+		switch c := c.(type) {
+		case float64:
+			if c != float64(int(c)) {
+				return nil, fmt.Errorf("%s[%d]: %v is not an index", key, k, c)
+			}
+			columns[k] = int(c)
+		case string:
+			columns[k] = c
+		default:
+			return nil, fmt.Errorf("%s[%d]: %v is neither a name nor an index", key, k, c)
+		}
+	}
+	return columns, nil
+}
+
+// rule builds the trigger rule described by the spec.
+func (rs RuleSpec) rule() (Rule, error) {
+	match := MatchPrefix
+	if rs.Match != "" {
+		m, ok := matchModes[strings.ToUpper(rs.Match)]
+		if !ok {
+			return Rule{}, fmt.Errorf("unknown match %q, use prefix, contains, exact, regex or bold", rs.Match)
+		}
+		match = m
+	}
+	action := SubtotalRow
+	if rs.Action != "" {
+		a, ok := actions[strings.ToLower(rs.Action)]
+		if !ok {
+			return Rule{}, fmt.Errorf("unknown action %q, use subtotal, section, multicolumn, midrule, pagebreak or skip", rs.Action)
+		}
+		action = a
+	}
+	if len(rs.Words) == 0 && match != MatchBold {
+		return Rule{}, fmt.Errorf("no words")
+	}
+	r := NewRule(rs.Column, match, action, rs.Words...)
+	if rs.Start != nil {
+		r.Start = *rs.Start
+	}
+	if rs.Span != nil {
+		r.Span = *rs.Span
+	}
+	if rs.Format != "" {
+		r.Format = rs.Format
+	}
+	if rs.Label != "" {
+		r.Label = rs.Label
+	}
+	if rs.Width != "" {
+		r.Width = rs.Width
+	}
+	r.MinCells = rs.MinCells
+	return r, r.compile()
+}
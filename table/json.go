@@ -0,0 +1,448 @@
+package table
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonSample is the number of objects JSON examines
+// to find the columns when Fields is nil.
+const jsonSample = 100
+
+// JSON reads the objects of a json source as rows: an array of
+// objects, objects one after the other, or a single object, as the
+// services return them, or with Lines set the objects one per line
+// of a JSON Lines (NDJSON) log. The first record is the names of the
+// columns, so the table always has a header and ColumnsByName selects
+// the keys. Nested objects are flattened to dotted paths, vendor.name
+// for the name of the vendor.
+//
+// Arrays are flattened into a single cell, their elements joined with
+// Separator, those of an array of objects path by path. The array at
+// the path Explode is exploded instead: each of its elements makes a
+// row, with the other fields of the object repeated.
+type JSON struct {
+	// Fields are the paths of the columns, in order. If nil they are
+	// the paths found in the first objects, in the order they appear,
+	// and the paths that only appear later are dropped.
+	Fields []string
+	// Explode is the path of the array whose elements are rows.
+	Explode string
+	// Separator joins the elements of arrays, "; " if empty.
+	Separator string
+	// Lines reads a JSON Lines source. A line that is not an object
+	// is reported and skipped, rather than end the reading.
+	Lines bool
+	LineOptions
+}
+
+// Open returns a reader of the rows of the json objects of r.
+func (j *JSON) Open(r io.Reader) RecordReader {
+	rd := &jsonReader{opt: *j, fields: j.Fields}
+	if rd.opt.Separator == "" {
+		rd.opt.Separator = "; "
+	}
+	if j.Lines {
+		rd.lines = newLineReader(r, j.Comment)
+	} else {
+		rd.lc = &lineCounter{r: r}
+		rd.dec = json.NewDecoder(rd.lc)
+		rd.dec.UseNumber()
+	}
+	return rd
+}
+
+// keyed is implemented by the readers whose first
+// record is the names of the columns.
+type keyed interface {
+	keyed()
+}
+
+type jsonReader struct {
+	opt JSON
+	// a JSON Lines source
+	lines *lineReader
+	// a json document
+	lc      *lineCounter
+	dec     *json.Decoder
+	started bool
+	array   bool
+
+	fields  []string
+	sampled bool
+	named   bool
+	// objects read ahead to find the fields
+	ahead []*jsonRow
+	// records of the object last read
+	queue   [][]string
+	current int
+	line    int
+	err     error
+}
+
+func (r *jsonReader) keyed() {}
+
+func (r *jsonReader) Read() ([]string, error) {
+	if err := r.sample(); err != nil {
+		return nil, err
+	}
+	if r.named {
+		return r.record()
+	}
+	r.named = true
+	// a source without objects, [] or an empty log, is an empty
+	// table, its header without names
+	if len(r.fields) == 0 && r.err != nil && r.err != io.EOF {
+		return nil, r.err
+	}
+	r.line = 1
+	if len(r.ahead) > 0 {
+		r.line = r.ahead[0].line
+	}
+	return append([]string(nil), r.fields...), nil
+}
+
+// record returns the next record of the rows.
+func (r *jsonReader) record() ([]string, error) {
+	for len(r.queue) == 0 {
+		var row *jsonRow
+		if len(r.ahead) > 0 {
+			row, r.ahead = r.ahead[0], r.ahead[1:]
+		} else {
+			row = r.next()
+		}
+		if row.err != nil {
+			return nil, row.err
+		}
+		r.queue, r.current = r.records(row), row.line
+	}
+	record := r.queue[0]
+	r.queue = r.queue[1:]
+	r.line = r.current
+	return record, nil
+}
+
+func (r *jsonReader) Line() int {
+	return r.line
+}
+
+// Skip skips the first n rows. The names of the
+// columns are still the first record.
+func (r *jsonReader) Skip(n int) error {
+	if err := r.sample(); err != nil {
+		return err
+	}
+	for ; n > 0; n-- {
+		if _, err := r.record(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample reads the first objects to find the fields,
+// unless they are given.
+func (r *jsonReader) sample() error {
+	if r.sampled {
+		return nil
+	}
+	r.sampled = true
+	if r.fields != nil {
+		return nil
+	}
+	known := map[string]bool{}
+	r.fields = []string{}
+	for len(r.ahead) < jsonSample {
+		row := r.next()
+		r.ahead = append(r.ahead, row)
+		if row.err == io.EOF {
+			break
+		}
+		for _, path := range row.paths {
+			if !known[path] {
+				known[path] = true
+				r.fields = append(r.fields, path)
+			}
+		}
+		if row.err != nil {
+			if _, ok := row.err.(*RecordError); !ok {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// records returns the records of an object, one for each element of
+// its exploded array or a single one.
+func (r *jsonReader) records(row *jsonRow) [][]string {
+	items := row.items
+	if len(items) == 0 {
+		items = []*jsonRow{nil}
+	}
+	records := make([][]string, len(items))
+	for k, item := range items {
+		record := make([]string, len(r.fields))
+		for c, path := range r.fields {
+			values, ok := row.values[path]
+			if item != nil {
+				if v, found := item.values[path]; found {
+					values, ok = v, true
+				}
+			}
+			if !ok {
+				continue
+			}
+			record[c] = strings.Join(values, r.opt.Separator)
+			if r.opt.Trim {
+				record[c] = strings.TrimSpace(record[c])
+			}
+		}
+		records[k] = record
+	}
+	return records
+}
+
+// next reads the next object. Errors are returned in the row, and
+// the errors that end the reading are returned again on every call.
+func (r *jsonReader) next() *jsonRow {
+	if r.err != nil {
+		return &jsonRow{err: r.err}
+	}
+	var row *jsonRow
+	var err error
+	if r.lines != nil {
+		row, err = r.nextLine()
+	} else {
+		row, err = r.nextValue()
+	}
+	if err != nil {
+		if _, ok := err.(*RecordError); !ok {
+			r.err = err
+		}
+		return &jsonRow{err: err}
+	}
+	return row
+}
+
+// nextLine reads the object of the next line of a JSON Lines source.
+func (r *jsonReader) nextLine() (*jsonRow, error) {
+	s, err := r.lines.next()
+	if err != nil {
+		return nil, err
+	}
+	line := r.lines.Line()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	var row *jsonRow
+	if err == nil {
+		row, err = r.parse(dec, tok, line)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && dec.More() {
+		err = fmt.Errorf("unexpected %q after the object", strings.TrimSpace(s[dec.InputOffset():]))
+	}
+	if err != nil {
+		if rerr, ok := err.(*RecordError); ok {
+			return nil, rerr
+		}
+		return nil, &RecordError{Line: line, Column: -1, Err: fmt.Errorf("json: %v", err)}
+	}
+	return row, nil
+}
+
+// nextValue reads the next object of a json document.
+func (r *jsonReader) nextValue() (*jsonRow, error) {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return nil, r.syntax(err)
+	}
+	if !r.started {
+		r.started = true
+		if tok == json.Delim('[') {
+			r.array = true
+			if tok, err = r.dec.Token(); err != nil {
+				return nil, r.syntax(err)
+			}
+		}
+	}
+	if r.array && tok == json.Delim(']') {
+		return nil, io.EOF
+	}
+	row, err := r.parse(r.dec, tok, r.lc.at(r.dec.InputOffset()-1))
+	if err == io.EOF {
+		// the value is cut short
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		if _, ok := err.(*RecordError); !ok {
+			return nil, r.syntax(err)
+		}
+	}
+	return row, err
+}
+
+// syntax adds the line to the errors of a json document. The end
+// of an array that is not closed is an error, but not that of a
+// document without values.
+func (r *jsonReader) syntax(err error) error {
+	switch {
+	case err == io.EOF && r.array:
+		// the array is not closed
+		err = io.ErrUnexpectedEOF
+	case err == io.EOF:
+		return err
+	}
+	if serr, ok := err.(*json.SyntaxError); ok {
+		return fmt.Errorf("json: line %d: %v", r.lc.at(serr.Offset), err)
+	}
+	return fmt.Errorf("json: line %d: %v", r.lc.at(r.dec.InputOffset()), err)
+}
+
+// parse reads a record that starts with tok, an object. Other
+// values are read all the same, and reported as ErrNotObject.
+func (r *jsonReader) parse(dec *json.Decoder, tok json.Token, line int) (*jsonRow, error) {
+	row := &jsonRow{line: line, values: map[string][]string{}}
+	p := jsonParser{dec: dec, explode: r.opt.Explode}
+	if tok != json.Delim('{') {
+		if err := p.token(row, "", tok); err != nil {
+			return nil, err
+		}
+		return nil, &RecordError{Line: line, Column: -1, Err: ErrNotObject}
+	}
+	if err := p.object(row, ""); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// jsonRow is an object flattened to the values at its paths.
+type jsonRow struct {
+	line   int
+	paths  []string
+	values map[string][]string
+	// items are the elements of the exploded array,
+	// whose paths are kept by their parent
+	items  []*jsonRow
+	parent *jsonRow
+	err    error
+}
+
+// key adds a path, in the order they appear.
+func (row *jsonRow) key(path string) {
+	for row.parent != nil {
+		row = row.parent
+	}
+	for _, p := range row.paths {
+		if p == path {
+			return
+		}
+	}
+	row.paths = append(row.paths, path)
+}
+
+func (row *jsonRow) add(path, v string) {
+	row.key(path)
+	row.values[path] = append(row.values[path], v)
+}
+
+// jsonParser flattens the values of a json decoder.
+type jsonParser struct {
+	dec     *json.Decoder
+	explode string
+}
+
+// object reads the members of an object after its opening brace.
+func (p *jsonParser) object(row *jsonRow, prefix string) error {
+	for p.dec.More() {
+		tok, err := p.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		tok, err = p.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := p.token(row, key, tok); err != nil {
+			return err
+		}
+	}
+	_, err := p.dec.Token()
+	return err
+}
+
+// token reads the value at path that starts with tok.
+func (p *jsonParser) token(row *jsonRow, path string, tok json.Token) error {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return p.object(row, path)
+		}
+		for p.dec.More() {
+			tok, err := p.dec.Token()
+			if err != nil {
+				return err
+			}
+			target := row
+			if path == p.explode && row.parent == nil {
+				target = &jsonRow{values: map[string][]string{}, parent: row}
+				row.items = append(row.items, target)
+			}
+			if err := p.token(target, path, tok); err != nil {
+				return err
+			}
+		}
+		_, err := p.dec.Token()
+		return err
+	case string:
+		row.add(path, v)
+	case json.Number:
+		row.add(path, v.String())
+	case bool:
+		row.add(path, strconv.FormatBool(v))
+	}
+	// nulls are left empty, and do not make a column of a
+	// path that is an object elsewhere
+	return nil
+}
+
+// lineCounter counts the lines of a source as it is read,
+// for the decoder to tell the line of an offset.
+type lineCounter struct {
+	r   io.Reader
+	off int64
+	// offsets of the newlines not passed yet
+	nl   []int64
+	line int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for k, b := range p[:n] {
+		if b == '\n' {
+			c.nl = append(c.nl, c.off+int64(k))
+		}
+	}
+	c.off += int64(n)
+	return n, err
+}
+
+// at returns the line of the byte at an offset, from 1.
+// The offsets must not go back from one call to the next.
+func (c *lineCounter) at(offset int64) int {
+	for len(c.nl) > 0 && c.nl[0] < offset {
+		c.nl = c.nl[1:]
+		c.line++
+	}
+	return c.line + 1
+}
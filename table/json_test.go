@@ -0,0 +1,146 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestJSON reads json sources and checks the columns found, the
+// rows and the records reported and skipped.
+func TestJSON(t *testing.T) {
+	const order = `{"code":"A1","vendor":{"name":"Acme","city":"Doha"},"tags":["pipe","steel"],` +
+		`"items":[{"sku":"P1","qty":2},{"sku":"P2","qty":3}],"paid":true,"note":null}`
+	tests := []struct {
+		name   string
+		format string
+		src    string
+		names  []string
+		rows   [][]string
+		errors []string // the records skipped, line: error
+	}{
+		{"dotted paths", "json", `[` + order + `]`,
+			[]string{"code", "vendor.name", "vendor.city", "tags", "items.sku", "items.qty", "paid"},
+			[][]string{{"A1", "Acme", "Doha", "pipe; steel", "P1; P2", "2; 3", "true"}}, nil},
+		{"exploded", "json:items", `[` + order + `]`,
+			[]string{"code", "vendor.name", "vendor.city", "tags", "items.sku", "items.qty", "paid"},
+			[][]string{
+				{"A1", "Acme", "Doha", "pipe; steel", "P1", "2", "true"},
+				{"A1", "Acme", "Doha", "pipe; steel", "P2", "3", "true"},
+			}, nil},
+		{"exploded without items", "json:items", `{"code":"A1","items":[]} {"code":"A2"}`,
+			[]string{"code"},
+			[][]string{{"A1"}, {"A2"}}, nil},
+		{"objects", "json", "{\"code\":\"A1\",\"qty\":2}\n{\"qty\":3,\"code\":\"A2\",\"unit\":\"m\"}",
+			[]string{"code", "qty", "unit"},
+			[][]string{{"A1", "2", ""}, {"A2", "3", "m"}}, nil},
+		{"single object", "json", `{"code":"A1","qty":2.50}`,
+			[]string{"code", "qty"},
+			[][]string{{"A1", "2.50"}}, nil},
+		{"values not objects", "json", `[{"code":"A1"},"A2",{"code":"A3"}]`,
+			[]string{"code"},
+			[][]string{{"A1"}, {"A3"}}, []string{"1: " + ErrNotObject.Error()}},
+		{"log", "jsonl", "{\"code\":\"A1\"}\n\n# a comment\n{\"code\":\"A2\",\"vendor\":{\"name\":\"Acme\"}}\n",
+			[]string{"code", "vendor.name"},
+			[][]string{{"A1", ""}, {"A2", "Acme"}}, nil},
+		{"bad lines", "jsonl", "{\"code\":\"A1\"}\nA2,Pipe\n[\"A3\"]\n{\"code\":\"A4\"} {\"code\":\"A5\"}\n{\"code\":\n{\"code\":\"A6\"}\n",
+			[]string{"code"},
+			[][]string{{"A1"}, {"A6"}}, []string{
+				"2: json: invalid character",
+				"3: " + ErrNotObject.Error(),
+				"4: json: unexpected",
+				"5: json: unexpected EOF",
+			}},
+		{"exploded log", "jsonl:items", `{"code":"A1","items":[{"sku":"P1"},{"sku":"P2"}]}`,
+			[]string{"code", "items.sku"},
+			[][]string{{"A1", "P1"}, {"A1", "P2"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := New()
+			in, err := NewInput(tt.format, LineOptions{Comment: "#"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tb.Input = in
+			if err := tb.Load(strings.NewReader(tt.src)); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range tb.ColumnInfo() {
+				names = append(names, c.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Errorf("columns %q, want %q", names, tt.names)
+			}
+			var rows [][]string
+			for i := 0; i < tb.Rows(); i++ {
+				rows = append(rows, Values(tb.Row(i)))
+			}
+			if fmt.Sprint(rows) != fmt.Sprint(tt.rows) {
+				t.Errorf("rows %q, want %q", rows, tt.rows)
+			}
+			if len(tb.Diagnostics) != len(tt.errors) {
+				t.Fatalf("diagnostics %v, want %d", tb.Diagnostics, len(tt.errors))
+			}
+			for k, err := range tb.Diagnostics {
+				var rerr *RecordError
+				if !errors.As(err, &rerr) {
+					t.Errorf("diagnostic %v is not a RecordError", err)
+					continue
+				}
+				if got := fmt.Sprintf("%d: %v", rerr.Line, rerr.Err); !strings.HasPrefix(got, tt.errors[k]) {
+					t.Errorf("diagnostic %q, want %q", got, tt.errors[k])
+				}
+			}
+		})
+	}
+}
+
+// TestJSONEmpty renders the json sources without objects as an
+// empty table, as an empty csv is, and those cut short as errors.
+func TestJSONEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		src    string
+		err    string
+	}{
+		{"empty array", "json", "[]", ""},
+		{"empty array exploded", "json:items", " [ ]\n", ""},
+		{"empty document", "json", "", ""},
+		{"empty log", "jsonl", "", ""},
+		{"blank log", "jsonl", "\n\n", ""},
+		{"comments only", "jsonl", "# no costs this period\n", ""},
+		{"csv", "csv", "", ""},
+		{"array not closed", "json", `[{"a":1}`, "unexpected EOF"},
+		{"object not closed", "json", `{"a":`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"latex", "html", "markdown", "text"} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				tb := New()
+				in, err := NewInput(tt.format, LineOptions{Comment: "#"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tb.Input = in
+				if tb.Renderer, err = NewRenderer(format); err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				err = tb.Render(&buf, strings.NewReader(tt.src), map[string]string{"type": "tabular"})
+				switch {
+				case tt.err == "" && err != nil:
+					t.Errorf("Render: %v", err)
+				case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+					t.Errorf("Render: %v, want an error with %q", err, tt.err)
+				case tt.err == "" && tb.Rows() != 0:
+					t.Errorf("%d rows, want none", tb.Rows())
+				}
+			})
+		}
+	}
+}
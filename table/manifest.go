@@ -0,0 +1,149 @@
+package table
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Manifest remembers what every output was rendered from: the hash
+// of its input and of its configuration. A job whose input and
+// configuration did not change since is not rendered again, so a
+// build only touches the tables that need it, and LaTeX only
+// reruns when a table really changed.
+type Manifest struct {
+	path string
+	mu   sync.Mutex
+	// Outputs maps the output files to their entries.
+	Outputs map[string]ManifestEntry `json:"outputs"`
+}
+
+// ManifestEntry is what an output was rendered from.
+type ManifestEntry struct {
+	Input  string `json:"input"`
+	Config string `json:"config"`
+}
+
+// LoadManifest reads the manifest kept in the file path. A
+// missing file is an empty manifest, every job is then stale.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path, Outputs: map[string]ManifestEntry{}}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if m.Outputs == nil {
+		m.Outputs = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// Save writes the manifest back to its file.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return replaceFile(m.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// Stale reports whether the job must be rendered: its output is
+// missing, or its input or configuration changed since it was
+// recorded.
+func (m *Manifest) Stale(j *Job) (bool, error) {
+	if _, err := os.Stat(j.Output); err != nil {
+		return true, nil
+	}
+	input, err := hashFile(j.Input)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.Outputs[j.Output]
+	return !ok || e != ManifestEntry{input, configHash(j)}, nil
+}
+
+// Record records that the job was rendered from the input
+// its table cleaned last.
+func (m *Manifest) Record(j *Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Outputs[j.Output] = ManifestEntry{j.Table.InputHash(), configHash(j)}
+}
+
+// Batch renders the stale jobs with Batch and records those that
+// succeeded. The other jobs are marked UpToDate and their error is
+// nil. The manifest is not saved.
+func (m *Manifest) Batch(ctx context.Context, workers int, jobs ...*Job) []error {
+	errs := make([]error, len(jobs))
+	var stale []*Job
+	var index []int
+	for k, j := range jobs {
+		ok, err := m.Stale(j)
+		switch {
+		case err != nil:
+			errs[k] = fmt.Errorf("%s: %w", j.Output, err)
+		case ok:
+			j.UpToDate = false
+			stale = append(stale, j)
+			index = append(index, k)
+		default:
+			j.UpToDate = true
+		}
+	}
+	if len(stale) == 0 {
+		return errs
+	}
+	for k, err := range Batch(ctx, workers, stale...) {
+		if err != nil {
+			errs[index[k]] = err
+			continue
+		}
+		m.Record(stale[k])
+	}
+	return errs
+}
+
+// configHash hashes what decides how a job is rendered,
+// the version of the package included.
+func configHash(j *Job) string {
+	b, _ := json.Marshal(struct {
+		Version, Config     string
+		Sections, Summation bool
+		Prop                map[string]string
+	}{Version, j.Config, j.Sections, j.Summation, j.Prop})
+	return hashBytes(b)
+}
+
+// hashFile returns the sha256 of a file, in hex.
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
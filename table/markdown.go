@@ -0,0 +1,89 @@
+package table
+
+import (
+	"bufio"
+	"strings"
+)
+
+// MarkdownRenderer renders a table as a GitHub flavoured markdown
+// table, for readmes and merge request comments. Markdown has no
+// spanning cells: a label is written in its first column and the
+// rest of its span left empty. Rules are dropped.
+type MarkdownRenderer struct {
+	layout
+}
+
+// NewMarkdownRenderer creates a markdown renderer.
+func NewMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{}
+}
+
+// markdownEscaper escapes the text of markdown cells.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", "<br>")
+
+// markdownCell returns the markdown of a cell.
+func markdownCell(c textCell) string {
+	s := markdownEscaper.Replace(c.text)
+	if c.bold && s != "" {
+		s = "**" + s + "**"
+	}
+	return s
+}
+
+// End writes the caption, if any, and the table. Markdown tables
+// have a single header row, so the rows of the head are joined
+// with line breaks. Without a head the names of the columns
+// are used.
+func (m *MarkdownRenderer) End() error {
+	w := bufio.NewWriter(m.out)
+	if len(m.cols) == 0 {
+		return w.Flush()
+	}
+	if c := m.t.CaptionStyle.Heading(); c != "" {
+		w.WriteString("**" + markdownEscaper.Replace(c) + "**\n\n")
+	}
+
+	head := make([]string, len(m.cols))
+	if len(m.head) == 0 {
+		for k, c := range m.cols {
+			head[k] = markdownEscaper.Replace(c.Name)
+		}
+	}
+	for _, record := range m.head {
+		for k, v := range record {
+			if k >= len(head) {
+				break
+			}
+			if head[k] != "" {
+				head[k] += "<br>"
+			}
+			head[k] += markdownEscaper.Replace(plainValue(Field{Value: v}))
+		}
+	}
+	w.WriteString("| " + strings.Join(head, " | ") + " |\n")
+
+	align := make([]string, len(m.cols))
+	for k := range m.cols {
+		switch m.align(k) {
+		case 'r':
+			align[k] = "---:"
+		case 'c':
+			align[k] = ":---:"
+		default:
+			align[k] = ":---"
+		}
+	}
+	w.WriteString("| " + strings.Join(align, " | ") + " |\n")
+
+	for _, row := range m.rows {
+		var cells []string
+		for _, c := range row.cells {
+			cells = append(cells, markdownCell(c))
+			for k := 1; k < c.span; k++ {
+				cells = append(cells, "")
+			}
+		}
+		w.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return w.Flush()
+}
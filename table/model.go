@@ -0,0 +1,422 @@
+package table
+
+import (
+	"encoding/csv"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Field represent a cell of a table. The raw text is kept
+// as read, next to its typed value.
+type Field struct {
+	// Name is the name of the column the cell belongs to.
+	Name  string
+	Value string
+	t     CellType
+	num   *big.Rat
+	date  time.Time
+	// mark is set on the cells that failed the audit.
+	mark bool
+	// bold is set on the cells of a workbook in a bold font.
+	bold bool
+}
+
+// Spreadsheet error values, as exported by excel.
+var excelErrors = []string{
+	"#DIV/0!", "#N/A", "#REF!", "#VALUE!", "#NAME?", "#NUM!", "#NULL!",
+	"#SPILL!", "#CALC!", "#GETTING_DATA",
+}
+
+// isExcelError reports if s is a spreadsheet error value.
+func isExcelError(s string) bool {
+	for _, e := range excelErrors {
+		if s == e {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number, ignoring grouping commas.
+func parseNumber(s string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(strings.Replace(s, ",", "", -1))
+}
+
+// parseDate parses s with any of the known date layouts.
+func parseDate(s string) (time.Time, bool) {
+	// no layout is longer, descriptions fail fast
+	if len(s) > maxDateLen || !strings.ContainsAny(s, "0123456789") {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// NewField creates a cell and determines its type. Numbers
+// and amounts are held as exact decimals.
+func NewField(name, s string) Field {
+	f := Field{Name: name, Value: s}
+	v := strings.TrimSpace(s)
+	if isExcelError(v) {
+		f.t = ErrorCell
+		return f
+	}
+	f.t = DetectType(v)
+	switch f.t {
+	case IntegerCell, DecimalCell:
+		f.num, _ = parseNumber(v)
+	case CurrencyCell:
+		v, _ = trimCurrency(v)
+		f.num, _ = parseNumber(v)
+	case DateCell:
+		f.date, _ = parseDate(v)
+	}
+	return f
+}
+
+// NewFields creates a row of cells from a record.
+func NewFields(record []string) []Field {
+	fields := make([]Field, len(record))
+	for k, v := range record {
+		fields[k] = NewField("", v)
+	}
+	return fields
+}
+
+// Type returns the type of the cell.
+func (f Field) Type() CellType {
+	return f.t
+}
+
+// Number returns the value of a numeric cell.
+func (f Field) Number() (*big.Rat, bool) {
+	if f.num == nil {
+		return nil, false
+	}
+	return f.num, true
+}
+
+// Date returns the value of a date cell.
+func (f Field) Date() (time.Time, bool) {
+	return f.date, f.t == DateCell
+}
+
+// Bold reports whether the cell is in a bold font in its
+// workbook. The cells of text sources are never bold.
+func (f Field) Bold() bool {
+	return f.bold
+}
+
+func (f Field) String() string {
+	return f.Value
+}
+
+// Values returns the raw text of a row of cells.
+func Values(fields []Field) []string {
+	record := make([]string, len(fields))
+	for k, f := range fields {
+		record[k] = f.Value
+	}
+	return record
+}
+
+// Load reads the whole table into memory. The first SkipN lines
+// are skipped and, if the table has a header, the next HeaderLines
+// are kept aside as the head of the table. The first of them
+// names the columns. Every other record becomes a row of
+// typed cells and every column is examined to find its
+// dominant type.
+//
+// Lines the csv reader cannot parse are skipped and reported
+// in t.Diagnostics. Any other read error is returned, as is
+// a selection made with ColumnsByName that cannot be resolved.
+func (t *Table) Load(r io.Reader) error {
+	names, err := t.open(r)
+	if err != nil {
+		return err
+	}
+	for {
+		row, line, err := t.readRow(names)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		t.lines = append(t.lines, line)
+		t.data = append(t.data, row)
+	}
+	return t.examine(names, t.data)
+}
+
+// HeaderMode says whether the first rows of a source are a header.
+type HeaderMode int
+
+// Header modes.
+const (
+	// HeaderDefault follows HasHeader and, for an Auto input
+	// without it, the header sniffed.
+	HeaderDefault HeaderMode = iota
+	// HeaderYes takes the first HeaderLines rows for the header.
+	HeaderYes
+	// HeaderNo reads the first rows as data, whatever was sniffed.
+	HeaderNo
+)
+
+// hasHeader reports whether the source has a header,
+// as HeaderMode, HasHeader or the sniffer say.
+func (t *Table) hasHeader() bool {
+	switch t.HeaderMode {
+	case HeaderYes:
+		return true
+	case HeaderNo:
+		return false
+	}
+	if t.HasHeader {
+		return true
+	}
+	_, auto := t.Input.(*Auto)
+	return auto && t.Sniffed.Header
+}
+
+// open starts reading a table: it skips the first SkipN lines and
+// keeps the header rows aside. It returns the names of the columns.
+func (t *Table) open(r io.Reader) ([]string, error) {
+	t.rd = t.input().Open(r)
+	t.header, t.headLines = t.hasHeader(), t.HeaderLines
+	// the keys of json objects are always the header
+	if _, ok := t.rd.(keyed); ok {
+		t.header, t.headLines = true, 1
+	}
+	if t.header && t.headLines == 0 {
+		t.headLines = 1
+	}
+	t.skiplines()
+
+	t.data = nil
+	t.lines = nil
+	t.headRows = nil
+	t.Err = nil
+	t.Diagnostics = nil
+	t.DroppedDiagnostics = 0
+	if !t.header {
+		return nil, nil
+	}
+	for i := 0; i < t.headLines; i++ {
+		record, err := t.Read()
+		if err != nil {
+			return nil, err
+		}
+		t.headRows = append(t.headRows, record)
+	}
+	if len(t.headRows) > 0 {
+		return t.headRows[0], nil
+	}
+	return nil, nil
+}
+
+// readRow reads the next record as a row of typed cells, with its
+// line in the source. Records the input cannot parse are
+// reported in t.Diagnostics and skipped. At the end it returns io.EOF.
+func (t *Table) readRow(names []string) ([]Field, int, error) {
+	for {
+		record, err := t.Read()
+		if perr, ok := err.(*csv.ParseError); ok {
+			t.warn(&RecordError{File: t.inpath, Line: perr.Line, Column: -1, Err: perr.Err})
+			continue
+		} else if rerr, ok := err.(*RecordError); ok {
+			t.warn(&RecordError{File: t.inpath, Line: rerr.Line, Column: rerr.Column, Err: rerr.Err})
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		line := t.rd.Line()
+		// the cells of a workbook are typed already
+		var cells []Cell
+		if cr, ok := t.rd.(CellReader); ok {
+			cells = cr.Cells()
+		}
+		row := make([]Field, len(record))
+		for k, v := range record {
+			name := ""
+			if k < len(names) {
+				name = names[k]
+			}
+			if k < len(cells) {
+				row[k] = cells[k].Field
+				row[k].Name, row[k].Value = name, v
+			} else {
+				row[k] = NewField(name, v)
+			}
+		}
+		return row, line, nil
+	}
+}
+
+// examine learns the columns from the rows and resolves the selection.
+func (t *Table) examine(names []string, rows [][]Field) error {
+	t.nrows = len(rows)
+	t.ncols = len(names)
+	for _, row := range rows {
+		if len(row) > t.ncols {
+			t.ncols = len(row)
+		}
+	}
+	// the names are known, resolve the selection
+	if len(t.selectedColumns) > 0 {
+		selector, err := t.GetColumns()
+		if err != nil {
+			return err
+		}
+		t.selector = selector
+	}
+	t.columns = make([]Column, t.ncols)
+	for k := range t.columns {
+		t.columns[k].Index = k
+		if k < len(names) {
+			t.columns[k].Name = names[k]
+		}
+	}
+	for _, row := range rows {
+		for k, f := range row {
+			t.columns[k].add(f.t, f.Value)
+		}
+	}
+	for k := range t.columns {
+		t.columns[k].Resolve()
+	}
+	if len(t.rawColumns) > 0 {
+		raw, err := selectColumns(names, t.ncols, t.rawColumns...)
+		if err != nil {
+			return err
+		}
+		for _, k := range raw {
+			t.columns[k].Raw = true
+		}
+	}
+	return nil
+}
+
+// rowIterator yields the rows of a table with their line in
+// the source, and io.EOF after the last one.
+type rowIterator func() ([]Field, int, error)
+
+// loaded iterates over the rows read by Load.
+func (t *Table) loaded() rowIterator {
+	i := 0
+	return func() ([]Field, int, error) {
+		if i >= len(t.data) {
+			return nil, 0, io.EOF
+		}
+		i++
+		line := 0
+		if i-1 < len(t.lines) {
+			line = t.lines[i-1]
+		}
+		return t.data[i-1], line, nil
+	}
+}
+
+// Rows returns the number of rows in the table.
+func (t *Table) Rows() int {
+	return t.nrows
+}
+
+// Row returns the cells of the i-th row.
+func (t *Table) Row(i int) []Field {
+	return t.data[i]
+}
+
+// Cell returns the cell at row i and column j. Short rows
+// return an empty cell.
+func (t *Table) Cell(i, j int) Field {
+	if j < len(t.data[i]) {
+		return t.data[i][j]
+	}
+	return Field{}
+}
+
+// ColumnInfo returns what has been learned about the columns
+// of the table, in source order.
+func (t *Table) ColumnInfo() []Column {
+	return t.columns
+}
+
+// pickColumns returns the metadata of the selected columns,
+// followed by any running totals.
+func (t *Table) pickColumns() []Column {
+	cols := t.columns
+	if len(t.selector) > 0 {
+		cols = make([]Column, len(t.selector))
+		for k, v := range t.selector {
+			if v < len(t.columns) {
+				cols[k] = t.columns[v]
+			}
+		}
+	}
+	for _, k := range t.Totals.Running {
+		if k < len(cols) {
+			c := cols[k]
+			c.Index = -1
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// headVector maps the selected columns of the line n of the head,
+// followed by the headings of the running totals: the heading of
+// their column, after "Cumulative" on the first line.
+func (t *Table) headVector(record []string, n int) ([]string, error) {
+	vector, err := t.Vector(record)
+	if err != nil {
+		return nil, err
+	}
+	// the record itself if no column is selected
+	vector = vector[:len(vector):len(vector)]
+	for _, k := range t.Totals.Running {
+		if k < len(vector) {
+			heading := vector[k]
+			if n == 0 && heading != "" {
+				heading = "Cumulative " + heading
+			}
+			vector = append(vector, heading)
+		}
+	}
+	return vector, nil
+}
+
+// VectorFields maps the selected columns of a row. Like
+// Vector it fails with a RecordError if the row is too short.
+func (t *Table) VectorFields(row []Field) ([]Field, error) {
+	if len(t.selector) == 0 {
+		return row, nil
+	}
+	vector := make([]Field, len(t.selector))
+	for k, v := range t.selector {
+		if v >= len(row) {
+			return nil, &RecordError{File: t.inpath, Column: v, Err: ErrShortRecord}
+		}
+		vector[k] = row[v]
+	}
+	return vector, nil
+}
+
+// lineVector maps the selected columns of a row and
+// places any error at the line of the row in the source.
+func (t *Table) lineVector(row []Field, line int) ([]Field, error) {
+	t.line = line
+	vector, err := t.VectorFields(row)
+	if rerr, ok := err.(*RecordError); ok {
+		rerr.Line = line
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.errorValues(vector, line)
+}
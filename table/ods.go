@@ -0,0 +1,575 @@
+package table
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ODS reads a sheet of an OpenDocument spreadsheet, as LibreOffice
+// saves them. As with XLSX the cells keep the types the sheet stores,
+// floats, percentages, currencies and dates, shown in their number
+// formats, and the rows and columns the file repeats are expanded.
+type ODS struct {
+	SheetOptions
+	LineOptions
+}
+
+func (o *ODS) binary() {}
+
+// Open reads the spreadsheet r and returns a reader of the rows
+// of the sheet. Errors are returned by the first Read.
+func (o *ODS) Open(r io.Reader) RecordReader {
+	s, err := ReadODS(r, o.SheetOptions, o.FillMerged)
+	if err != nil {
+		return failedReader{err}
+	}
+	return newSheetReader(s, o.LineOptions)
+}
+
+// ReadODS reads a sheet of the OpenDocument spreadsheet r, as the
+// options select it. With fill, the merged regions are filled
+// with their value.
+func ReadODS(r io.Reader, opt SheetOptions, fill bool) (*Sheet, error) {
+	z, err := readZip(r)
+	if err != nil {
+		return nil, fmt.Errorf("ods: %v", err)
+	}
+	st := &odsStyles{cells: map[string]*odsCellStyle{}, data: map[string]*odsDataStyle{}}
+	if err := zipWalk(z, "styles.xml", st.walk); err != nil {
+		return nil, fmt.Errorf("ods: %v", err)
+	}
+	// the first pass finds the sheets and the automatic styles
+	var names []string
+	err = zipWalk(z, "content.xml", func(dec *xml.Decoder, se xml.StartElement) error {
+		if se.Name.Local == "table" && isTableNS(se.Name.Space) {
+			names = append(names, attr(se, "name"))
+			return dec.Skip()
+		}
+		return st.walk(dec, se)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ods: %v", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("ods: not a spreadsheet, content.xml has no tables")
+	}
+	k, err := opt.pickSheet(names)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &odsParser{styles: st, sheet: &Sheet{Name: names[k]}}
+	n := 0
+	err = zipWalk(z, "content.xml", func(dec *xml.Decoder, se xml.StartElement) error {
+		if se.Name.Local != "table" || !isTableNS(se.Name.Space) {
+			return nil
+		}
+		n++
+		if n-1 != k {
+			return dec.Skip()
+		}
+		return p.table(dec)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ods: %w", err)
+	}
+	if err := opt.finish(p.sheet, fill); err != nil {
+		return nil, err
+	}
+	return p.sheet, nil
+}
+
+// zipWalk calls visit with every element of a member of a zip
+// archive. A member that is missing is not an error, for the
+// styles.xml that some writers leave out.
+func zipWalk(z *zip.Reader, name string, visit func(dec *xml.Decoder, se xml.StartElement) error) error {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		dec := xml.NewDecoder(rc)
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if se, ok := tok.(xml.StartElement); ok {
+				if err := visit(dec, se); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isTableNS(space string) bool {
+	return strings.HasSuffix(space, ":table:1.0")
+}
+
+// attr returns the attribute of an element by its local name.
+func attr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// attrInt returns an integer attribute, def if it is missing.
+func attrInt(se xml.StartElement, local string, def int) int {
+	if n, err := strconv.Atoi(attr(se, local)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// odsCellStyle is a cell style, which may take its
+// number format and weight from its parent.
+type odsCellStyle struct {
+	parent string
+	data   string
+	bold   *bool
+}
+
+// odsDataStyle is a number style, turned into a number format
+// code as excel writes them. positive is the style mapped to the
+// positive numbers, if the style is the one of the negatives.
+type odsDataStyle struct {
+	code     string
+	positive string
+}
+
+type odsStyles struct {
+	cells map[string]*odsCellStyle
+	data  map[string]*odsDataStyle
+}
+
+// walk records the styles found in the element se.
+func (st *odsStyles) walk(dec *xml.Decoder, se xml.StartElement) error {
+	switch local := se.Name.Local; {
+	case local == "style" && attr(se, "family") == "table-cell":
+		cs := &odsCellStyle{parent: attr(se, "parent-style-name"), data: attr(se, "data-style-name")}
+		st.cells[attr(se, "name")] = cs
+		return st.cellStyle(dec, cs)
+	case strings.HasSuffix(local, "-style") && strings.HasSuffix(se.Name.Space, ":datastyle:1.0"):
+		ds := &odsDataStyle{}
+		st.data[attr(se, "name")] = ds
+		return ds.read(dec, local)
+	}
+	return nil
+}
+
+// cellStyle reads the font weight of a cell style.
+func (st *odsStyles) cellStyle(dec *xml.Decoder, cs *odsCellStyle) error {
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Local == "text-properties" {
+				if w := attr(t, "font-weight"); w != "" {
+					bold := w == "bold" || w >= "600" && w <= "900"
+					cs.bold = &bold
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// read builds the code of a number style from its elements.
+func (ds *odsDataStyle) read(dec *xml.Decoder, kind string) error {
+	var b strings.Builder
+	var text *strings.Builder
+	long := func(se xml.StartElement) bool { return attr(se, "style") == "long" }
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "number":
+				code := "0"
+				if attr(t, "grouping") == "true" {
+					code = "#,##0"
+				}
+				if n := attrInt(t, "decimal-places", 0); n > 0 {
+					code += "." + strings.Repeat("0", n)
+				}
+				b.WriteString(code)
+			case "scientific-number":
+				b.WriteString("0.00E+00")
+			case "fraction":
+				b.WriteString("# ?/?")
+			case "text", "currency-symbol":
+				text = &strings.Builder{}
+			case "day":
+				b.WriteString(map[bool]string{true: "dd", false: "d"}[long(t)])
+			case "day-of-week":
+				b.WriteString(map[bool]string{true: "dddd", false: "ddd"}[long(t)])
+			case "month":
+				switch textual := attr(t, "textual") == "true"; {
+				case textual && long(t):
+					b.WriteString("mmmm")
+				case textual:
+					b.WriteString("mmm")
+				case long(t):
+					b.WriteString("mm")
+				default:
+					b.WriteString("m")
+				}
+			case "year":
+				b.WriteString(map[bool]string{true: "yyyy", false: "yy"}[long(t)])
+			case "hours":
+				b.WriteString(map[bool]string{true: "hh", false: "h"}[long(t)])
+			case "minutes":
+				b.WriteString(map[bool]string{true: "mm", false: "m"}[long(t)])
+			case "seconds":
+				b.WriteString(map[bool]string{true: "ss", false: "s"}[long(t)])
+			case "am-pm":
+				b.WriteString("AM/PM")
+			case "map":
+				if c := attr(t, "condition"); strings.Contains(c, ">=0") || strings.Contains(c, ">0") {
+					ds.positive = attr(t, "apply-style-name")
+				}
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			depth--
+			switch {
+			case text == nil:
+			case t.Name.Local == "currency-symbol":
+				b.WriteString("[$" + text.String() + "]")
+				text = nil
+			case t.Name.Local == "text":
+				if s := text.String(); s == "%" && kind == "percentage-style" {
+					b.WriteString("%")
+				} else if s != "" {
+					b.WriteString(`"` + s + `"`)
+				}
+				text = nil
+			}
+		}
+	}
+	ds.code = b.String()
+	return nil
+}
+
+// resolve returns the number format and the weight of a cell style.
+func (st *odsStyles) resolve(name string) (code string, bold bool) {
+	data, weight := "", (*bool)(nil)
+	for k := 0; name != "" && k < 10; k++ {
+		cs := st.cells[name]
+		if cs == nil {
+			break
+		}
+		if data == "" {
+			data = cs.data
+		}
+		if weight == nil {
+			weight = cs.bold
+		}
+		name = cs.parent
+	}
+	if ds := st.data[data]; ds != nil {
+		if pos := st.data[ds.positive]; pos != nil {
+			ds = pos
+		}
+		code = ds.code
+	}
+	return code, weight != nil && *weight
+}
+
+// odsParser reads the rows of a table of content.xml.
+type odsParser struct {
+	styles *odsStyles
+	sheet  *Sheet
+	row    int
+	// the cells with a value and the merges expanded so far
+	cells int
+	// the default style of the columns, as runs
+	colStyles []odsRun
+}
+
+type odsRun struct {
+	n     int
+	style string
+}
+
+// columnStyle returns the default style of the column k.
+func (p *odsParser) columnStyle(k int) string {
+	for _, run := range p.colStyles {
+		if k < run.n {
+			return run.style
+		}
+		k -= run.n
+	}
+	return ""
+}
+
+// maxCells bounds the cells with a value and the merges of a sheet,
+// as its repeated rows and columns expand, against files that repeat
+// them to the last row and column.
+const maxCells = 1 << 22
+
+// expand counts n times per more cells of the sheet,
+// an error past maxCells.
+func (p *odsParser) expand(n, per int) error {
+	if per == 0 {
+		return nil
+	}
+	if n > (maxCells-p.cells)/per {
+		return fmt.Errorf("%w: the sheet %s repeats its rows and columns past %d cells", ErrTooManyCells, p.sheet.Name, maxCells)
+	}
+	p.cells += n * per
+	return nil
+}
+
+// table reads the rows of a table, the row groups
+// and header rows being transparent.
+func (p *odsParser) table(dec *xml.Decoder) error {
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table-column":
+				p.colStyles = append(p.colStyles, odsRun{attrInt(t, "number-columns-repeated", 1), attr(t, "default-cell-style-name")})
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+			case "table-row":
+				if err := p.tableRow(dec, attrInt(t, "number-rows-repeated", 1)); err != nil {
+					return err
+				}
+			case "table-row-group", "table-header-rows", "table-rows",
+				"table-column-group", "table-header-columns", "table-columns":
+				depth++
+			default:
+				// shapes, named ranges and the like
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// tableRow reads a row, repeated n times.
+func (p *odsParser) tableRow(dec *xml.Decoder, n int) error {
+	var cells []Cell
+	var spans []CellRange // relative to the row
+	col := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			repeat := attrInt(t, "number-columns-repeated", 1)
+			if t.Name.Local != "table-cell" {
+				// covered cells of a merge
+				col += repeat
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			c, err := p.cell(dec, t, col)
+			if err != nil {
+				return err
+			}
+			if rows, cols := attrInt(t, "number-rows-spanned", 1), attrInt(t, "number-columns-spanned", 1); rows > 1 || cols > 1 {
+				spans = append(spans, CellRange{0, col, rows - 1, col + cols - 1})
+			}
+			if c.Value != "" {
+				if err := p.expand(repeat, 1); err != nil {
+					return err
+				}
+				for k := 0; k < repeat; k++ {
+					c.Col = col + k
+					cells = append(cells, c)
+				}
+			}
+			col += repeat
+		case xml.EndElement:
+			if len(cells) > 0 || len(spans) > 0 {
+				// the cells of the first of the rows are counted already
+				if err := p.expand(n-1, len(cells)); err != nil {
+					return err
+				}
+				if err := p.expand(n, len(spans)); err != nil {
+					return err
+				}
+				for k := 0; k < n; k++ {
+					row := append([]Cell(nil), cells...)
+					for j := range row {
+						row[j].Row = p.row + k
+					}
+					p.sheet.Rows = append(p.sheet.Rows, row)
+					for _, s := range spans {
+						s.Row += p.row + k
+						s.LastRow += p.row + k
+						p.sheet.Merged = append(p.sheet.Merged, s)
+					}
+				}
+			}
+			p.row += n
+			return nil
+		}
+	}
+}
+
+// cell reads a cell of the column col, its value typed
+// as the sheet stores it and shown in its number format.
+func (p *odsParser) cell(dec *xml.Decoder, se xml.StartElement, col int) (Cell, error) {
+	text, err := odsText(dec)
+	if err != nil {
+		return Cell{}, err
+	}
+	style := attr(se, "style-name")
+	if style == "" {
+		style = p.columnStyle(col)
+	}
+	code, bold := p.styles.resolve(style)
+	c := Cell{Row: p.row, Col: col, Format: code}
+	nf := parseNumberFormat(code)
+
+	// office:value-type, calcext:value-type says error
+	// for the error values, text as far as office knows
+	valueType := ""
+	for _, a := range se.Attr {
+		if a.Name.Local == "value-type" && strings.HasSuffix(a.Name.Space, ":office:1.0") {
+			valueType = a.Value
+		}
+	}
+	switch valueType {
+	case "float", "percentage", "currency":
+		num, ok := new(big.Rat).SetString(attr(se, "value"))
+		if !ok {
+			c.Field = NewField("", text)
+			break
+		}
+		if valueType == "percentage" && !nf.percent {
+			nf.percent = true
+		}
+		if valueType == "currency" && nf.currency == "" {
+			nf.currency = attr(se, "currency")
+		}
+		c.Field = numberCell(num, nf)
+	case "date":
+		d, ok := odsDate(attr(se, "date-value"))
+		if !ok {
+			c.Field = NewField("", text)
+			break
+		}
+		if nf.layout == "" {
+			nf.layout, nf.date = "2006-01-02", true
+			if d.Hour() != 0 || d.Minute() != 0 || d.Second() != 0 {
+				nf.layout = "2006-01-02 15:04"
+			}
+		}
+		c.Field = dateCell(d, nf)
+	case "boolean":
+		c.Field = Field{Value: "FALSE", t: CodeCell}
+		if attr(se, "boolean-value") == "true" {
+			c.Field.Value = "TRUE"
+		}
+	default:
+		// strings, times and the error values
+		// are as the sheet shows them
+		c.Field = NewField("", text)
+	}
+	c.bold = bold
+	return c, nil
+}
+
+// odsDate parses a date-value, a date with or without its time.
+func odsDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// odsText reads the text of a cell, its paragraphs on lines of
+// their own. The annotations, comments of the cell, are left out.
+func odsText(dec *xml.Decoder) (string, error) {
+	var b strings.Builder
+	paragraphs := 0
+	inText := 0
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "annotation":
+				if err := dec.Skip(); err != nil {
+					return "", err
+				}
+				depth--
+			case "p", "h":
+				if paragraphs > 0 {
+					b.WriteString("\n")
+				}
+				paragraphs++
+				inText++
+			case "s":
+				b.WriteString(strings.Repeat(" ", attrInt(t, "c", 1)))
+			case "tab":
+				b.WriteString("\t")
+			case "line-break":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText > 0 {
+				b.Write(t)
+			}
+		case xml.EndElement:
+			depth--
+			if t.Name.Local == "p" || t.Name.Local == "h" {
+				inText--
+			}
+		}
+	}
+	return b.String(), nil
+}
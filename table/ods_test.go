@@ -0,0 +1,191 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const odsStylesXML = `<office:automatic-styles>
+<number:number-style style:name="N1"><number:number number:decimal-places="2" number:grouping="true"/></number:number-style>
+<number:percentage-style style:name="P1"><number:number number:decimal-places="1"/><number:text>%</number:text></number:percentage-style>
+<number:currency-style style:name="C1"><number:currency-symbol>€</number:currency-symbol><number:number number:decimal-places="2" number:grouping="true"/></number:currency-style>
+<number:date-style style:name="D1"><number:day number:style="long"/><number:text>.</number:text><number:month number:style="long"/><number:text>.</number:text><number:year number:style="long"/></number:date-style>
+<style:style style:name="num" style:family="table-cell" style:data-style-name="N1"/>
+<style:style style:name="pct" style:family="table-cell" style:data-style-name="P1"/>
+<style:style style:name="eur" style:family="table-cell" style:data-style-name="C1"/>
+<style:style style:name="day" style:family="table-cell" style:data-style-name="D1"/>
+<style:style style:name="bold" style:family="table-cell"><style:text-properties fo:font-weight="bold"/></style:style>
+<style:style style:name="boldnum" style:family="table-cell" style:parent-style-name="bold" style:data-style-name="N1"/>
+</office:automatic-styles>`
+
+// spreadsheet returns an OpenDocument spreadsheet of a single
+// table, Costs, with the rows given.
+func spreadsheet(t *testing.T, rows string) []byte {
+	return zipOf(t, map[string]string{
+		"content.xml": `<office:document-content` +
+			` xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+			` xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"` +
+			` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"` +
+			` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+			` xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0"` +
+			` xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0">` +
+			odsStylesXML + `<office:body><office:spreadsheet><table:table table:name="Costs">` +
+			rows + `</table:table></office:spreadsheet></office:body></office:document-content>`,
+	})
+}
+
+func TestReadODSValues(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string // the attributes and content of <table:table-cell>
+		want string
+		typ  CellType
+	}{
+		{"string", ` office:value-type="string"><text:p>Hex nut</text:p>`, "Hex nut", TextCell},
+		{"paragraphs", ` office:value-type="string"><text:p>Hex nut</text:p><text:p>M12 zinc</text:p>`, "Hex nut\nM12 zinc", TextCell},
+		{"float", ` office:value-type="float" office:value="1234.5"><text:p>1234.5</text:p>`, "1234.5", DecimalCell},
+		{"float formatted", ` office:value-type="float" office:value="1234.5" table:style-name="num"><text:p>1,234.50</text:p>`, "1,234.50", DecimalCell},
+		{"integer", ` office:value-type="float" office:value="42"><text:p>42</text:p>`, "42", IntegerCell},
+		{"percentage", ` office:value-type="percentage" office:value="0.125" table:style-name="pct"><text:p>12.5%</text:p>`, "12.5%", DecimalCell},
+		{"currency", ` office:value-type="currency" office:currency="EUR" office:value="1500" table:style-name="eur"><text:p>€1,500.00</text:p>`, "€1,500.00", CurrencyCell},
+		{"date", ` office:value-type="date" office:date-value="2023-03-15"><text:p>15/03/23</text:p>`, "2023-03-15", DateCell},
+		{"date and time", ` office:value-type="date" office:date-value="2023-03-15T18:00:00"><text:p>15/03/23 18:00</text:p>`, "2023-03-15 18:00", DateCell},
+		{"date formatted", ` office:value-type="date" office:date-value="2023-03-15" table:style-name="day"><text:p>15.03.2023</text:p>`, "15.03.2023", DateCell},
+		{"boolean", ` office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p>`, "TRUE", CodeCell},
+		{"bad float", ` office:value-type="float" office:value="n/a"><text:p>1.5</text:p>`, "1.5", DecimalCell},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := `<table:table-row><table:table-cell` + tt.cell + `</table:table-cell></table:table-row>`
+			s, err := ReadODS(bytes.NewReader(spreadsheet(t, rows)), SheetOptions{}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Rows) != 1 || len(s.Rows[0]) != 1 {
+				t.Fatalf("read %d rows, want one cell", len(s.Rows))
+			}
+			c := s.Rows[0][0]
+			if c.Value != tt.want || c.Type() != tt.typ {
+				t.Errorf("cell %q, %v, want %q, %v", c.Value, c.Type(), tt.want, tt.typ)
+			}
+		})
+	}
+}
+
+// odsCosts has its header bold, a category spanning three rows, a
+// row of items repeated, and trailing rows and columns repeated to
+// the end of the sheet without values, as LibreOffice saves them.
+const odsCosts = `<table:table-column table:number-columns-repeated="3"/><table:table-column table:number-columns-repeated="16381"/>
+<table:table-row>` +
+	`<table:table-cell table:style-name="bold" office:value-type="string"><text:p>Group</text:p></table:table-cell>` +
+	`<table:table-cell table:style-name="bold" office:value-type="string"><text:p>Item</text:p></table:table-cell>` +
+	`<table:table-cell table:style-name="bold" office:value-type="string"><text:p>Cost</text:p></table:table-cell>` +
+	`<table:table-cell table:number-columns-repeated="16381"/></table:table-row>
+<table:table-row>` +
+	`<table:table-cell table:number-rows-spanned="3" office:value-type="string"><text:p>Civil</text:p></table:table-cell>` +
+	`<table:table-cell office:value-type="string"><text:p>Pipe</text:p></table:table-cell>` +
+	`<table:table-cell office:value-type="float" office:value="100" table:style-name="num"><text:p>100.00</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="2">` +
+	`<table:covered-table-cell/>` +
+	`<table:table-cell office:value-type="string"><text:p>Steel bolt</text:p></table:table-cell>` +
+	`<table:table-cell office:value-type="float" office:value="50" table:style-name="num"><text:p>50.00</text:p></table:table-cell></table:table-row>
+<table:table-row>` +
+	`<table:table-cell table:style-name="bold" table:number-columns-spanned="2" office:value-type="string"><text:p>SUBTOTAL</text:p></table:table-cell>` +
+	`<table:covered-table-cell/>` +
+	`<table:table-cell table:style-name="boldnum" office:value-type="float" office:value="200"><text:p>200.00</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1048571"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>`
+
+func TestReadODSLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   SheetOptions
+		fill  bool
+		cells [][]string
+	}{
+		{"sheet", SheetOptions{}, false, [][]string{
+			{"Group", "Item", "Cost"},
+			{"Civil", "Pipe", "100.00"},
+			{"", "Steel bolt", "50.00"},
+			{"", "Steel bolt", "50.00"},
+			{"SUBTOTAL", "", "200.00"},
+		}},
+		{"filled", SheetOptions{Sheet: "Costs"}, true, [][]string{
+			{"Group", "Item", "Cost"},
+			{"Civil", "Pipe", "100.00"},
+			{"Civil", "Steel bolt", "50.00"},
+			{"Civil", "Steel bolt", "50.00"},
+			{"SUBTOTAL", "SUBTOTAL", "200.00"},
+		}},
+		{"range", SheetOptions{Range: "A2:B3"}, true, [][]string{
+			{"Civil", "Pipe"},
+			{"Civil", "Steel bolt"},
+		}},
+		{"range below the merge", SheetOptions{Range: "A3:B4"}, true, [][]string{
+			{"", "Steel bolt"},
+			{"", "Steel bolt"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ReadODS(bytes.NewReader(spreadsheet(t, odsCosts)), tt.opt, tt.fill)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]string
+			for _, row := range s.Rows {
+				got = append(got, Values(cellFields(row)))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.cells) {
+				t.Errorf("cells %q, want %q", got, tt.cells)
+			}
+		})
+	}
+
+	s, err := ReadODS(bytes.NewReader(spreadsheet(t, odsCosts)), SheetOptions{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := s.Rows[1][0]; c.RowSpan != 3 || c.ColSpan != 1 {
+		t.Errorf("A2 spans %dx%d, want 3x1", c.RowSpan, c.ColSpan)
+	}
+	if c := s.Rows[4][0]; c.RowSpan != 1 || c.ColSpan != 2 {
+		t.Errorf("A5 spans %dx%d, want 1x2", c.RowSpan, c.ColSpan)
+	}
+	for _, c := range []Cell{s.Rows[2][0], s.Rows[3][0], s.Rows[4][1]} {
+		if !c.Merged {
+			t.Errorf("%s is not merged", cellName(c.Row, c.Col))
+		}
+	}
+	for k, bold := range []bool{true, false, false, false, true} {
+		if s.Rows[k][0].Bold() != bold {
+			t.Errorf("row %d: bold %v, want %v", k+1, !bold, bold)
+		}
+	}
+	// the style of the subtotal takes its weight from its parent
+	if c := s.Rows[4][2]; !c.Bold() || c.Type() != DecimalCell {
+		t.Errorf("C5 %q, bold %v, %v, want a bold number", c.Value, c.Bold(), c.Type())
+	}
+}
+
+func TestReadODSTooManyCells(t *testing.T) {
+	cell := `<table:table-cell office:value-type="string"><text:p>x</text:p></table:table-cell>`
+	tests := []struct {
+		name string
+		rows string
+	}{
+		{"repeated", `<table:table-row table:number-rows-repeated="65536"><table:table-cell table:number-columns-repeated="65536" office:value-type="string"><text:p>x</text:p></table:table-cell></table:table-row>`},
+		{"wide", `<table:table-row><table:table-cell table:number-columns-repeated="9000000000000000000" office:value-type="string"><text:p>x</text:p></table:table-cell></table:table-row>`},
+		{"tall", `<table:table-row table:number-rows-repeated="9000000000000000000">` + cell + `</table:table-row>`},
+		{"spans", `<table:table-row table:number-rows-repeated="9000000000000000000"><table:table-cell table:number-rows-spanned="2"/></table:table-row>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadODS(bytes.NewReader(spreadsheet(t, tt.rows)), SheetOptions{}, false)
+			if !errors.Is(err, ErrTooManyCells) {
+				t.Errorf("ReadODS: %v, want ErrTooManyCells", err)
+			}
+		})
+	}
+}
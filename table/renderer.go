@@ -0,0 +1,157 @@
+package table
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"ml/rules"
+	"strconv"
+	"strings"
+)
+
+// Renderer typesets a table in an output format. The table drives
+// the rendering: it reads the rows, applies the triggers and computes
+// the totals, and tells the renderer what each row is. The renderer
+// only decides how it looks. The same Table configuration can thus
+// be rendered as LaTeX, the default, or in any other format.
+type Renderer interface {
+	// Begin opens the table and writes its caption and head.
+	Begin(t *Table, w io.Writer) error
+	// Row writes a detail row.
+	Row(fields []Field)
+	// Span writes a row whose label spans a few columns, as
+	// described by the rule. These are the subtotal rows of the
+	// spreadsheet and the rows of the MulticolumnRow rules.
+	Span(rule *Rule, fields []Field)
+	// Section writes a section heading spanning all the columns.
+	Section(title, width string)
+	// Rule draws a rule of the given width before the next row.
+	Rule(width string)
+	// PageBreak starts a new page before the next row.
+	PageBreak()
+	// Blank writes the separator used for empty records.
+	Blank()
+	// Total writes a total computed by the package. There is a
+	// field for every column, and the label takes the place of
+	// the span fields from at. A span of 0 leaves it out.
+	Total(label string, at, span int, fields []Field)
+	// End closes the table and flushes the output.
+	End() error
+}
+
+// NewRenderer returns the renderer of a format: "latex",
+// "html", "markdown" or "text". An empty format is latex.
+func NewRenderer(format string) (Renderer, error) {
+	switch strings.ToLower(format) {
+	case "", "latex", "tex":
+		return &latex{}, nil
+	case "html":
+		return NewHTMLRenderer(), nil
+	case "markdown", "md":
+		return NewMarkdownRenderer(), nil
+	case "text", "txt":
+		return NewTextRenderer(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q, use latex, html, markdown or text", format)
+}
+
+// renderer returns the renderer set in t.Renderer or,
+// if none, the LaTeX one.
+func (t *Table) renderer() Renderer {
+	if t.Renderer != nil {
+		return t.Renderer
+	}
+	return &latex{}
+}
+
+// latex is the LaTeX renderer, the one the package has always used.
+type latex struct {
+	t *Table
+	w *bufio.Writer
+}
+
+// midrule returns a midrule, of the default width if width is empty.
+func midrule(width string) string {
+	if width == "" {
+		return rules.MidRule()
+	}
+	return rules.MidRule(width)
+}
+
+func (l *latex) Begin(t *Table, w io.Writer) error {
+	l.t = t
+	t.w = bufio.NewWriter(w)
+	l.w = t.w
+	fmt.Fprintln(l.w, t.Begin(l.w, t.prop))
+	return t.renderHead()
+}
+
+func (l *latex) Row(fields []Field) {
+	l.t.processRow(l.w, fields)
+	if l.t.prop["rowlines"] == "true" {
+		fmt.Fprintln(l.w, "\\hline")
+	}
+}
+
+func (l *latex) Span(rule *Rule, fields []Field) {
+	vector := l.t.texValues(fields)
+	if l.t.Audit.Highlight != "" {
+		for k, f := range fields {
+			if f.mark {
+				vector[k] = `\cellcolor{` + l.t.Audit.Highlight + `}` + vector[k]
+			}
+		}
+	}
+	if rule.Action != SubtotalRow {
+		fmt.Fprintln(l.w, rule.multicolumn(vector))
+		return
+	}
+	fmt.Fprintln(l.w, midrule(rule.Width))
+	fmt.Fprintln(l.w, rule.multicolumn(vector))
+	fmt.Fprintln(l.w, midrule(rule.Width))
+	l.t.AddVertSpace(l.w, len(vector))
+}
+
+func (l *latex) Section(title, width string) {
+	fmt.Fprintf(l.w, "%s\n", AddSection(EscapeLaTeX(title), len(l.t.pickColumns())))
+	fmt.Fprintln(l.w, midrule(width))
+}
+
+func (l *latex) Rule(width string) {
+	fmt.Fprintln(l.w, midrule(width))
+}
+
+func (l *latex) PageBreak() {
+	fmt.Fprintln(l.w, "\\pagebreak")
+}
+
+func (l *latex) Blank() {
+	fmt.Fprintln(l.w, "\\hline")
+}
+
+func (l *latex) Total(label string, at, span int, fields []Field) {
+	var cells []string
+	for k := 0; k < len(fields); k++ {
+		if k == at && span > 0 {
+			cells = append(cells, `\multicolumn{`+strconv.Itoa(span)+`}{l}{\textbf{`+EscapeLaTeX(label)+`}}`)
+			k += span - 1
+			continue
+		}
+		v := fields[k].Value
+		if fields[k].num != nil {
+			v = formatNumber(v)
+		}
+		cells = append(cells, v)
+	}
+	width := l.t.Totals.Width
+	if width == "" {
+		width = "1.5pt"
+	}
+	fmt.Fprintln(l.w, rules.MidRule(width))
+	fmt.Fprintln(l.w, strings.Join(cells, " &")+" \\\\")
+	fmt.Fprintln(l.w, rules.MidRule(width))
+}
+
+func (l *latex) End() error {
+	return l.t.closeTabular(l.w)
+}
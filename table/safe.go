@@ -0,0 +1,185 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultSafeCommands are the control sequences that the cells of
+// raw columns may use in safe mode, if t.SafeCommands is nil.
+var DefaultSafeCommands = []string{
+	"textbf", "textit", "emph", "textsc", "underline",
+	"textsuperscript", "textsubscript",
+	"num", "SI", "si", "qty", "unit",
+}
+
+// safeSymbols are the control symbols allowed in safe mode, the
+// escapes of the specials and spaces. A \\ would end the row.
+const safeSymbols = `&%$#_{}, ;!`
+
+// safeTeX neutralises the LaTeX of a raw cell so that no control
+// sequence but the allowed ones reaches the output, and the cell
+// cannot break out of its place in the row. It returns the safe
+// text and what was neutralised:
+//
+//   - control words not allowed, printed as text: \input
+//     becomes \textbackslash{}input;
+//   - control symbols other than the escapes of the specials;
+//   - ^^ notation, which can spell any character, a backslash
+//     included, as ^^5c;
+//   - & and % that would end the cell or comment out the row,
+//     and # outside of a definition;
+//   - braces that do not pair, which could close a group the
+//     table opened, or a group opened in a formula and left open;
+//   - a $ without its pair, and _ and ^ outside of a formula,
+//     which all stop the compilation with "Missing $ inserted";
+//   - line breaks, an empty line being a new paragraph,
+//     and the other control characters.
+func safeTeX(s string, allow map[string]bool) (string, []string) {
+	var b strings.Builder
+	var found []string
+	rs := []rune(s)
+	paired := pairDollars(rs)
+	depth := 0
+	// the depth of the braces where the formula opened, or -1
+	math := -1
+	for k := 0; k < len(rs); k++ {
+		r := rs[k]
+		switch {
+		case r == '$' && !paired[k]:
+			b.WriteString(`\$`)
+			found = append(found, "unpaired $")
+		case r == '$' && math < 0:
+			math = depth
+			b.WriteRune(r)
+		case r == '$':
+			if depth > math {
+				b.WriteString(strings.Repeat("}", depth-math))
+				found = append(found, "unpaired {")
+				depth = math
+			}
+			math = -1
+			b.WriteRune(r)
+		case (r == '_' || r == '^' && (k+1 == len(rs) || rs[k+1] != '^')) && math < 0:
+			b.WriteString(EscapeLaTeX(string(r)))
+			found = append(found, string(r))
+		case r == '\\' && k+1 < len(rs) && isLetter(rs[k+1]):
+			j := k + 1
+			for j < len(rs) && isLetter(rs[j]) {
+				j++
+			}
+			name := string(rs[k+1 : j])
+			if allow[name] {
+				b.WriteString(`\` + name)
+			} else {
+				b.WriteString(`\textbackslash{}` + name)
+				found = append(found, `\`+name)
+			}
+			k = j - 1
+		case r == '\\' && k+1 < len(rs):
+			k++
+			if strings.ContainsRune(safeSymbols, rs[k]) {
+				b.WriteString(`\` + string(rs[k]))
+				continue
+			}
+			b.WriteString(`\textbackslash{}` + EscapeLaTeX(string(rs[k])))
+			found = append(found, `\`+string(rs[k]))
+		case r == '\\':
+			b.WriteString(`\textbackslash{}`)
+			found = append(found, `\`)
+		case r == '^' && k+1 < len(rs) && rs[k+1] == '^':
+			j := k + 2
+			for j < len(rs) && j < k+4 && isHex(rs[j]) {
+				j++
+			}
+			if j == k+2 && j < len(rs) {
+				j++ // ^^ followed by any character
+			}
+			b.WriteString(EscapeLaTeX(string(rs[k:j])))
+			found = append(found, string(rs[k:j]))
+			k = j - 1
+		case r == '&' || r == '%' || r == '#':
+			b.WriteString(`\` + string(r))
+			found = append(found, string(r))
+		case r == '{':
+			depth++
+			b.WriteRune(r)
+		case r == '}' && (depth == 0 || depth == math):
+			b.WriteString(`\}`)
+			found = append(found, "unpaired }")
+		case r == '}':
+			depth--
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if depth > 0 {
+		b.WriteString(strings.Repeat("}", depth))
+		found = append(found, "unpaired {")
+	}
+	return b.String(), found
+}
+
+// pairDollars returns the positions of the $ that open and close
+// a formula, in pairs from the start. The escaped \$ are not counted
+// and an odd $ at the end has no pair.
+func pairDollars(rs []rune) map[int]bool {
+	var at []int
+	for k := 0; k < len(rs); k++ {
+		switch rs[k] {
+		case '\\':
+			k++
+		case '$':
+			at = append(at, k)
+		}
+	}
+	paired := make(map[int]bool, len(at))
+	for k := 0; k+1 < len(at); k += 2 {
+		paired[at[k]], paired[at[k+1]] = true, true
+	}
+	return paired
+}
+
+// isLetter reports whether r is a letter of TeX control words.
+func isLetter(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func isHex(r rune) bool {
+	return strings.ContainsRune("0123456789abcdef", r)
+}
+
+// safeCommands returns the control words allowed in safe mode.
+func (t *Table) safeCommands() map[string]bool {
+	names := t.SafeCommands
+	if names == nil {
+		names = DefaultSafeCommands
+	}
+	allow := make(map[string]bool, len(names))
+	for _, name := range names {
+		allow[strings.TrimPrefix(name, `\`)] = true
+	}
+	return allow
+}
+
+// safeValue returns the LaTeX of the raw cell of a column. In
+// safe mode it is neutralised and reported in t.Diagnostics.
+func (t *Table) safeValue(column int, v string) string {
+	if !t.Safe {
+		return v
+	}
+	safe, found := safeTeX(v, t.safeCommands())
+	if len(found) > 0 {
+		t.warn(&RecordError{
+			File:   t.inpath,
+			Line:   t.line,
+			Column: column,
+			Err:    fmt.Errorf("%w: %s", ErrUnsafeTeX, strings.Join(found, " ")),
+		})
+	}
+	return safe
+}
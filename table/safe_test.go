@@ -0,0 +1,202 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSafeTeX(t *testing.T) {
+	allow := map[string]bool{"textbf": true, "num": true}
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		found []string
+	}{
+		{"plain", "Steel pipe", "Steel pipe", nil},
+		{"allowed", `\textbf{Total}`, `\textbf{Total}`, nil},
+		{"input", `\input{/etc/passwd}`, `\textbackslash{}input{/etc/passwd}`, []string{`\input`}},
+		{"write18", `\immediate\write18{rm -rf /}`, `\textbackslash{}immediate\textbackslash{}write18{rm -rf /}`, []string{`\immediate`, `\write`}},
+		{"catcode", `\catcode` + "`" + `\^^M=13`, `\textbackslash{}catcode` + "`" + `\textbackslash{}\textasciicircum{}\textasciicircum{}M=13`, []string{`\catcode`, `\^`, "^"}},
+		{"hat notation", `^^5cinput`, `\textasciicircum{}\textasciicircum{}5cinput`, []string{"^^5c"}},
+		{"hat any", `^^M`, `\textasciicircum{}\textasciicircum{}M`, []string{"^^M"}},
+		{"escaped specials", `50\% \& \$ \#`, `50\% \& \$ \#`, nil},
+		{"ampersand", "R&D", `R\&D`, []string{"&"}},
+		{"percent", "10% off", `10\% off`, []string{"%"}},
+		{"hash", "#1", `\#1`, []string{"#"}},
+		{"close brace", "a}b", `a\}b`, []string{"unpaired }"}},
+		{"open brace", "{a", "{a}", []string{"unpaired {"}},
+		{"braces", "{a}{b}", "{a}{b}", nil},
+		{"line breaks", "a\nb\r\n\nc", "a b   c", nil},
+		{"tab", "a\tb", "a b", nil},
+		{"row end", `a\\b`, `a\textbackslash{}\textbackslash{}b`, []string{`\\`}},
+		{"backslash at end", `a\`, `a\textbackslash{}`, []string{`\`}},
+		{"math", `$x_1^2$`, `$x_1^2$`, nil},
+		{"lone dollar", "$5", `\$5`, []string{"unpaired $"}},
+		{"odd dollars", "$a$ $", `$a$ \$`, []string{"unpaired $"}},
+		{"underscore", "a_b", `a\_b`, []string{"_"}},
+		{"caret", "x^2", `x\textasciicircum{}2`, []string{"^"}},
+		{"math then text", "$a_b$ c_d", `$a_b$ c\_d`, []string{"_"}},
+		{"brace left open in math", "${a$ b", "${a}$ b", []string{"unpaired {"}},
+		{"brace closed in math", "{$a}$", `{$a\}$}`, []string{"unpaired }", "unpaired {"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := safeTeX(tt.in, allow)
+			if got != tt.want {
+				t.Errorf("safeTeX(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !reflect.DeepEqual(found, tt.found) {
+				t.Errorf("safeTeX(%q) found %q, want %q", tt.in, found, tt.found)
+			}
+		})
+	}
+}
+
+// hostile is a csv whose header and cells try to escape the table.
+const hostile = "code,formula\n" +
+	"1,\\input{/etc/passwd}\n" +
+	"2,^^5cinput{x}\n" +
+	"3,}\\end{tabular}\n" +
+	"4,R&D 10% #1\n" +
+	"5,\"a\n\nb\"\n" +
+	"6,$5 a_b\n" +
+	"7,\\textbf{ok} $x^2$\n"
+
+// safeTable cleans a csv in safe mode, with the raw columns named.
+func safeTable(t *testing.T, src string, raw ...interface{}) *Table {
+	dir, err := ioutil.TempDir("", "safe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "hostile.csv")
+	if err := ioutil.WriteFile(fname, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tb := New()
+	tb.HasHeader = true
+	tb.Safe = true
+	tb.RawColumns(raw...)
+	if _, err := tb.Clean(fname); err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestSafeRender(t *testing.T) {
+	tb := safeTable(t, hostile, "formula")
+	var buf bytes.Buffer
+	if err := tb.Render(&buf, bytes.NewReader(tb.Raw), map[string]string{"type": "tabular"}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, bad := range []string{`\input`, `^^5c`, `}\end{tabular}`, "R&D", "10% ", " #1", "a\n\nb", "& $5", " a_b"} {
+		if strings.Contains(out, bad) {
+			t.Errorf("output contains %q:\n%s", bad, out)
+		}
+	}
+	for _, good := range []string{`\textbf{ok}`, `$x^2$`, `\textbackslash{}input`, `R\&D 10\% \#1`, `\$5 a\_b`} {
+		if !strings.Contains(out, good) {
+			t.Errorf("output lacks %q:\n%s", good, out)
+		}
+	}
+
+	want := map[int]string{
+		2: `\input`,
+		3: "^^5c",
+		4: "unpaired }",
+		5: "& % #",
+		9: "unpaired $ _",
+	}
+	got := map[int]string{}
+	for _, err := range tb.Diagnostics {
+		var rerr *RecordError
+		if !errors.As(err, &rerr) || !errors.Is(err, ErrUnsafeTeX) {
+			t.Errorf("diagnostic %v is not an ErrUnsafeTeX RecordError", err)
+			continue
+		}
+		if rerr.Column != 1 {
+			t.Errorf("diagnostic %v: column %d, want 1", err, rerr.Column)
+		}
+		got[rerr.Line] = strings.TrimPrefix(rerr.Err.Error(), ErrUnsafeTeX.Error()+": ")
+	}
+	for line, found := range want {
+		if !strings.Contains(got[line], found) {
+			t.Errorf("line %d: diagnostic %q, want it to report %q", line, got[line], found)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("diagnostics on lines %v, want %v", got, want)
+	}
+}
+
+func TestSafeProcessRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []string
+		want   string
+		found  string
+	}{
+		{"input", []string{"1", `\input{x}`}, `\textbackslash{}input{x}`, `\input`},
+		{"hat notation", []string{"2", "^^5c"}, `\textasciicircum{}\textasciicircum{}5c`, "^^5c"},
+		{"unpaired brace", []string{"3", "a}"}, `a\}`, "unpaired }"},
+		{"specials", []string{"4", "&%#"}, `\&\%\#`, "& % #"},
+		{"line break", []string{"5", "a\nb"}, "a b", ""},
+		{"math", []string{"6", "$a$ b_c"}, `$a$ b\_c`, "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := safeTable(t, "code,formula\n0,x\n", "formula")
+			if err := tb.Load(bytes.NewReader(tb.Raw)); err != nil {
+				t.Fatal(err)
+			}
+			tb.Diagnostics = nil
+			got := tb.ProcessRecord(nil, tt.record)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("ProcessRecord(%q) = %q, want it to contain %q", tt.record, got, tt.want)
+			}
+			switch {
+			case tt.found == "" && len(tb.Diagnostics) > 0:
+				t.Errorf("unexpected diagnostics %v", tb.Diagnostics)
+			case tt.found != "" && (len(tb.Diagnostics) != 1 || !strings.HasSuffix(tb.Diagnostics[0].Error(), tt.found)):
+				t.Errorf("diagnostics %v, want one reporting %q", tb.Diagnostics, tt.found)
+			}
+		})
+	}
+}
+
+func TestSafeHeader(t *testing.T) {
+	src := "code,\\input{x} & #1 50% a_b $\n1,2\n"
+	tb := safeTable(t, src, "code")
+	for _, manual := range []bool{false, true} {
+		if !manual {
+			tb.Header.M = nil
+		} else {
+			tb.Header.M = [][]string{{"SR", `\write18{x} }`}}
+		}
+		var buf bytes.Buffer
+		if err := tb.Render(&buf, bytes.NewReader(tb.Raw), map[string]string{"type": "tabular"}); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		for _, bad := range []string{`\input`, `\write18`, " & #1", "50% ", "a_b", " $"} {
+			if strings.Contains(out, bad) {
+				t.Errorf("manual %v: head contains %q:\n%s", manual, bad, out)
+			}
+		}
+		want := `\textbackslash{}input\{x\} \& \#1 50\% a\_b \$`
+		if manual {
+			want = `\textbackslash{}write18\{x\} \}`
+		}
+		if !strings.Contains(out, want) {
+			t.Errorf("manual %v: head lacks %q:\n%s", manual, want, out)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package table
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SectionTitles maps the codes found in a column to section
+// titles. A code is matched against the longest prefix in Titles,
+// so that "SUB-SMR" can have its own title next to "SUB".
+//
+// Section titles are a weird feature but necessary if we are exporting
+// from excel for enterprise style spreadsheets. These in many instances
+// have numerous rows with subtotals, notes and the like. Every project
+// has its own vocabulary, which is why the titles are data.
+type SectionTitles struct {
+	Titles map[string]string
+	// Column is the source column holding the codes.
+	Column int
+	// Fallback is the title of codes without a mapping. A %s in
+	// it is replaced by the code. If empty the code itself is used.
+	Fallback string
+
+	unmapped map[string]bool
+}
+
+// NewSectionTitles creates a mapping that reads the codes
+// from the second column, as in our cost reports.
+func NewSectionTitles(titles map[string]string) *SectionTitles {
+	return &SectionTitles{Titles: titles, Column: 1}
+}
+
+// LoadSectionTitles reads a mapping from a file. A .json file
+// holds a single object of prefix to title. Any other file is read
+// as csv with the prefix in the first column and the title in the second.
+func LoadSectionTitles(path string) (*SectionTitles, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	titles := map[string]string{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&titles); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return NewSectionTitles(titles), nil
+	}
+
+	rd := csv.NewReader(f)
+	rd.FieldsPerRecord = 2
+	rd.TrimLeadingSpace = true
+	records, err := rd.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, record := range records {
+		titles[strings.TrimSpace(record[0])] = strings.TrimSpace(record[1])
+	}
+	return NewSectionTitles(titles), nil
+}
+
+// Title returns the title of the section a code belongs to. The
+// second value is false if no prefix matched and the fallback was used.
+func (s *SectionTitles) Title(code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	best := -1
+	title := ""
+	for prefix, v := range s.Titles {
+		if strings.HasPrefix(code, prefix) && len(prefix) > best {
+			best = len(prefix)
+			title = v
+		}
+	}
+	if best >= 0 {
+		return title, true
+	}
+
+	if s.unmapped == nil {
+		s.unmapped = map[string]bool{}
+	}
+	s.unmapped[code] = true
+	switch {
+	case s.Fallback == "":
+		return code, false
+	case strings.Contains(s.Fallback, "%s"):
+		return fmt.Sprintf(s.Fallback, code), false
+	}
+	return s.Fallback, false
+}
+
+// Unmapped returns, sorted, the codes that had no title.
+func (s *SectionTitles) Unmapped() []string {
+	codes := make([]string, 0, len(s.unmapped))
+	for code := range s.unmapped {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// sectionTitle returns the title of the section opened by a record.
+// Without a mapping the code itself is the title.
+func (t *Table) sectionTitle(record []string) string {
+	column := 1
+	if t.SectionTitles != nil {
+		column = t.SectionTitles.Column
+	}
+	code := ""
+	if column < len(record) {
+		code = record[column]
+	}
+	if t.SectionTitles == nil {
+		return strings.TrimSpace(code)
+	}
+	title, _ := t.SectionTitles.Title(code)
+	return title
+}
+
+// warnUnmapped reports the codes that had no section title.
+func (t *Table) warnUnmapped() {
+	if t.SectionTitles == nil {
+		return
+	}
+	if codes := t.SectionTitles.Unmapped(); len(codes) > 0 {
+		t.warn(fmt.Errorf("no section title for %s", strings.Join(codes, ", ")))
+	}
+}
+
+// legacyTitles are the titles GetSectionTitle has always given.
+var legacyTitles = map[string]string{
+	"TEC":          "SECTION THEME EXPERIENCE CENTER",
+	"SUB-SMR":      "SECTION SMART SYSTEMS",
+	"SUB-E":        "SECTION SUBCONTRACTS IN CORE CONTRACT",
+	"SUB-M":        "SECTION SUBCONTRACT PS",
+	"GEN":          "SECTION INDIRECT SITE COSTS",
+	"PC-":          "SECTION PC SUMS (All)",
+	"HVAC":         "SECTION HVAC",
+	"EL-EQ":        "SECTION ELECTRICAL",
+	"SUBCONTRACTS": "SECTION SUBCONTRACTS",
+}
+
+// GetSectionTitle returns the title of the section of a code from
+// the titles of the Doha Oasis cost reports.
+//
+// Deprecated: set Table.SectionTitles, or use SectionTitles.Title.
+func GetSectionTitle(s string) string {
+	titles := SectionTitles{Titles: legacyTitles, Fallback: "SECTION UNKNOWN"}
+	title, _ := titles.Title(s)
+	return title
+}
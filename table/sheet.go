@@ -0,0 +1,459 @@
+package table
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Cell is a cell of a spreadsheet: its typed value, as the workbook
+// stores it rather than guessed from its text, and what the export
+// to csv loses, the number format, the font weight and the merges.
+type Cell struct {
+	Field
+	// Format is the number format of the cell, such as #,##0.00.
+	Format string
+	// Row and Col are the position of the cell in its sheet,
+	// from zero: Row 2 and Col 1 is B3.
+	Row, Col int
+	// RowSpan and ColSpan are the size of the merged region
+	// that starts at the cell, one by one if it is not merged.
+	RowSpan, ColSpan int
+	// Merged is set on the cells of a merged region but its first,
+	// which are empty unless the sheet is read with FillMerged.
+	Merged bool
+}
+
+// Sheet is a worksheet of a workbook.
+type Sheet struct {
+	Name string
+	// Rows are the cells of the sheet, all rows as wide as the widest
+	// and without the empty rows at the end, as excel exports them.
+	Rows [][]Cell
+	// Merged are the merged regions of the sheet.
+	Merged []CellRange
+}
+
+// CellRange is a rectangle of cells of a sheet, its corners included,
+// counted from zero. A range open at the end has LastRow or LastCol -1.
+type CellRange struct {
+	Row, Col         int
+	LastRow, LastCol int
+}
+
+var (
+	cellRef    = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]+)$`)
+	rangeCells = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]+):\$?([A-Za-z]{1,3})\$?([0-9]+)$`)
+	rangeCols  = regexp.MustCompile(`^\$?([A-Za-z]{1,3}):\$?([A-Za-z]{1,3})$`)
+	rangeRows  = regexp.MustCompile(`^\$?([0-9]+):\$?([0-9]+)$`)
+)
+
+// ParseRange parses a range as excel writes them: A1:F40, B:F for
+// whole columns, 3:40 for whole rows, or a single cell such as B3.
+func ParseRange(s string) (CellRange, error) {
+	s = strings.TrimSpace(s)
+	row := func(n string) int {
+		k, _ := strconv.Atoi(n)
+		return k - 1
+	}
+	var r CellRange
+	switch m := []string(nil); {
+	case rangeCells.MatchString(s):
+		m = rangeCells.FindStringSubmatch(s)
+		r = CellRange{row(m[2]), letterIndex(m[1]), row(m[4]), letterIndex(m[3])}
+	case rangeCols.MatchString(s):
+		m = rangeCols.FindStringSubmatch(s)
+		r = CellRange{0, letterIndex(m[1]), -1, letterIndex(m[2])}
+	case rangeRows.MatchString(s):
+		m = rangeRows.FindStringSubmatch(s)
+		r = CellRange{row(m[1]), 0, row(m[2]), -1}
+	case cellRef.MatchString(s):
+		m = cellRef.FindStringSubmatch(s)
+		r = CellRange{row(m[2]), letterIndex(m[1]), row(m[2]), letterIndex(m[1])}
+	default:
+		return r, fmt.Errorf("%w: %q is not a range such as A1:F40, B:F or 3:40", errInvalidRange, s)
+	}
+	if r.Row < 0 || r.LastRow >= 0 && r.LastRow < r.Row || r.LastCol >= 0 && r.LastCol < r.Col {
+		return r, fmt.Errorf("%w: %q ends before it starts", errInvalidRange, s)
+	}
+	return r, nil
+}
+
+// Contains reports whether the cell at row and col is in the range.
+func (r CellRange) Contains(row, col int) bool {
+	return row >= r.Row && (r.LastRow < 0 || row <= r.LastRow) &&
+		col >= r.Col && (r.LastCol < 0 || col <= r.LastCol)
+}
+
+func (r CellRange) String() string {
+	switch {
+	case r.LastRow < 0:
+		return columnName(r.Col) + ":" + columnName(r.LastCol)
+	case r.LastCol < 0:
+		return strconv.Itoa(r.Row+1) + ":" + strconv.Itoa(r.LastRow+1)
+	}
+	return cellName(r.Row, r.Col) + ":" + cellName(r.LastRow, r.LastCol)
+}
+
+// columnName returns the letters of a column, A for 0.
+func columnName(k int) string {
+	s := ""
+	for k++; k > 0; k = (k - 1) / 26 {
+		s = string(rune('A'+(k-1)%26)) + s
+	}
+	return s
+}
+
+// cellName returns the reference of a cell, as B3.
+func cellName(row, col int) string {
+	return columnName(col) + strconv.Itoa(row+1)
+}
+
+// parseCell parses a cell reference such as B3.
+func parseCell(s string) (row, col int, ok bool) {
+	m := cellRef.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	n, _ := strconv.Atoi(m[2])
+	return n - 1, letterIndex(m[1]), true
+}
+
+// SheetOptions are the settings of the spreadsheet inputs.
+type SheetOptions struct {
+	// Sheet is the name of the sheet to read, or its position
+	// from 1 as the tabs are ordered. The first if empty.
+	Sheet string
+	// Range limits the cells read, as ParseRange accepts them.
+	// The whole sheet if empty.
+	Range string
+}
+
+// parseSheetFormat splits the sheet and range of an input
+// format such as "xlsx:Costs!A3:F40".
+func parseSheetFormat(spec string) SheetOptions {
+	var opt SheetOptions
+	if n := strings.LastIndex(spec, "!"); n >= 0 {
+		opt.Sheet, opt.Range = spec[:n], spec[n+1:]
+	} else {
+		opt.Sheet = spec
+	}
+	opt.Sheet = strings.Trim(opt.Sheet, "'")
+	return opt
+}
+
+// pickSheet returns the position of the sheet
+// among the names, as the options select it.
+func (o SheetOptions) pickSheet(names []string) (int, error) {
+	if o.Sheet == "" && len(names) > 0 {
+		return 0, nil
+	}
+	for k, name := range names {
+		if name == o.Sheet {
+			return k, nil
+		}
+	}
+	for k, name := range names {
+		if strings.EqualFold(name, o.Sheet) {
+			return k, nil
+		}
+	}
+	if k, err := strconv.Atoi(o.Sheet); err == nil && k >= 1 && k <= len(names) {
+		return k - 1, nil
+	}
+	return 0, fmt.Errorf("%w %q, the workbook has %s", ErrUnknownSheet, o.Sheet, strings.Join(names, ", "))
+}
+
+// finish crops the sheet to the range of the options, merges
+// its cells and pads its rows, once all its cells are read.
+func (o SheetOptions) finish(s *Sheet, fill bool) error {
+	var r CellRange
+	if o.Range != "" {
+		var err error
+		if r, err = ParseRange(o.Range); err != nil {
+			return err
+		}
+	} else {
+		r = CellRange{0, 0, -1, -1}
+	}
+
+	// the cells as read are sparse, in rows of their own; the
+	// sheet is as wide as its cells with a value, and a cell with
+	// only a style, such as a border far to the right, adds nothing
+	width := 0
+	for _, cells := range s.Rows {
+		for _, c := range cells {
+			if c.Value != "" && r.Contains(c.Row, c.Col) && c.Col-r.Col+1 > width {
+				width = c.Col - r.Col + 1
+			}
+		}
+	}
+	starts := map[[2]int]bool{}
+	for _, m := range s.Merged {
+		starts[[2]int{m.Row, m.Col}] = true
+	}
+	var rows [][]Cell
+	for _, cells := range s.Rows {
+		for _, c := range cells {
+			if !r.Contains(c.Row, c.Col) || c.Value == "" && !starts[[2]int{c.Row, c.Col}] {
+				continue
+			}
+			row, col := c.Row-r.Row, c.Col-r.Col
+			if col >= width {
+				continue
+			}
+			for len(rows) <= row {
+				rows = append(rows, nil)
+			}
+			for len(rows[row]) <= col {
+				rows[row] = append(rows[row], Cell{})
+			}
+			rows[row][col] = c
+		}
+	}
+	// empty rows at the end are dropped, cells after the last
+	// one with a value too, as the export to csv does
+	for len(rows) > 0 && blankRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	for k := range rows {
+		for len(rows[k]) < width {
+			rows[k] = append(rows[k], Cell{})
+		}
+		for j := range rows[k] {
+			c := &rows[k][j]
+			c.Row, c.Col = k+r.Row, j+r.Col
+			c.RowSpan, c.ColSpan = 1, 1
+		}
+	}
+	s.Rows = rows
+
+	// the merges are clipped to the cells read, a merge can
+	// cover the whole sheet, A1:XFD1048576
+	if len(rows) == 0 || width == 0 {
+		return nil
+	}
+	bounds := CellRange{r.Row, r.Col, r.Row + len(rows) - 1, r.Col + width - 1}
+	for _, m := range s.Merged {
+		// nil if the first cell, which holds the value, was not read
+		first := s.cell(m.Row, m.Col)
+		clip := m
+		if clip.Row < bounds.Row {
+			clip.Row = bounds.Row
+		}
+		if clip.Col < bounds.Col {
+			clip.Col = bounds.Col
+		}
+		if clip.LastRow > bounds.LastRow {
+			clip.LastRow = bounds.LastRow
+		}
+		if clip.LastCol > bounds.LastCol {
+			clip.LastCol = bounds.LastCol
+		}
+		for row := clip.Row; row <= clip.LastRow; row++ {
+			for col := clip.Col; col <= clip.LastCol; col++ {
+				c := s.cell(row, col)
+				if c == first {
+					c.RowSpan, c.ColSpan = clip.LastRow-m.Row+1, clip.LastCol-m.Col+1
+					continue
+				}
+				c.Merged = true
+				if fill && first != nil {
+					c.Field = first.Field
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cell returns the cell at row and col of the sheet, nil if
+// it falls out of the cells read.
+func (s *Sheet) cell(row, col int) *Cell {
+	if len(s.Rows) == 0 || len(s.Rows[0]) == 0 {
+		return nil
+	}
+	row -= s.Rows[0][0].Row
+	col -= s.Rows[0][0].Col
+	if row < 0 || row >= len(s.Rows) || col < 0 || col >= len(s.Rows[row]) {
+		return nil
+	}
+	return &s.Rows[row][col]
+}
+
+func blankRow(cells []Cell) bool {
+	for _, c := range cells {
+		if c.Value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// CellReader is implemented by the record readers of spreadsheets.
+// The table reads the typed cells of a record rather than guess
+// the types from the text.
+type CellReader interface {
+	RecordReader
+	// Cells returns the cells of the record last read.
+	Cells() []Cell
+}
+
+// sheetReader reads the rows of a sheet as records.
+type sheetReader struct {
+	sheet *Sheet
+	opt   LineOptions
+	next  int
+	cells []Cell
+}
+
+func newSheetReader(s *Sheet, opt LineOptions) *sheetReader {
+	return &sheetReader{sheet: s, opt: opt}
+}
+
+func (s *sheetReader) Read() ([]string, error) {
+	for s.next < len(s.sheet.Rows) {
+		s.cells = s.sheet.Rows[s.next]
+		s.next++
+		if s.opt.Comment != "" && len(s.cells) > 0 && strings.HasPrefix(strings.TrimSpace(s.cells[0].Value), s.opt.Comment) {
+			continue
+		}
+		record := make([]string, len(s.cells))
+		for k, c := range s.cells {
+			record[k] = c.Value
+			if s.opt.Trim {
+				record[k] = strings.TrimSpace(c.Value)
+			}
+		}
+		return record, nil
+	}
+	s.cells = nil
+	return nil, io.EOF
+}
+
+// Line returns the row of the sheet, from 1 as excel numbers them.
+func (s *sheetReader) Line() int {
+	if len(s.cells) == 0 {
+		if s.next > 0 && s.next <= len(s.sheet.Rows) && len(s.sheet.Rows[s.next-1]) > 0 {
+			return s.sheet.Rows[s.next-1][0].Row + 1
+		}
+		return 0
+	}
+	return s.cells[0].Row + 1
+}
+
+func (s *sheetReader) Cells() []Cell {
+	return s.cells
+}
+
+// failedReader returns the error of an input
+// that could not be opened at every read.
+type failedReader struct {
+	err error
+}
+
+func (f failedReader) Read() ([]string, error) { return nil, f.err }
+func (f failedReader) Line() int               { return 0 }
+
+// binary is implemented by the inputs of binary sources, the
+// workbooks, which are neither converted to UTF-8 nor cleaned.
+type binary interface {
+	binary()
+}
+
+// isBinary reports whether the table reads a binary source.
+func (t *Table) isBinary() bool {
+	_, ok := t.input().(binary)
+	return ok
+}
+
+// readZip reads a whole zip archive from r.
+func readZip(r io.Reader) (*zip.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
+
+// zipXML decodes the XML of a member of a zip archive into v.
+// It returns false, and no error, if there is no such member.
+func zipXML(z *zip.Reader, name string, v interface{}) (bool, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return true, err
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(rc).Decode(v); err != nil {
+			return true, fmt.Errorf("%s: %v", name, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// numberCell returns the cell of a number, in the format the
+// spreadsheet shows it: with its decimals, grouped thousands, as
+// a percentage or an amount in a currency.
+func numberCell(v *big.Rat, nf numberFormat) Field {
+	if nf.percent {
+		v = new(big.Rat).Mul(v, big.NewRat(100, 1))
+	}
+	var s string
+	if nf.decimals < 0 {
+		f, _ := v.Float64()
+		// the 15 digits excel shows in General
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	} else {
+		s = v.FloatString(nf.decimals)
+	}
+	if nf.grouping {
+		s = groupThousands(s)
+	}
+	f := Field{Value: s, num: v, t: DetectType(s)}
+	switch {
+	case nf.percent:
+		f.Value += "%"
+		f.t = DecimalCell
+	case nf.currency != "":
+		f.Value = nf.currency + f.Value
+		if isCurrencyCode(nf.currency) && !strings.ContainsAny(nf.currency, currencyRunes) {
+			// EUR 12.50
+			f.Value = nf.currency + " " + s
+		}
+		f.t = CurrencyCell
+	}
+	return f
+}
+
+// groupThousands puts commas between the thousands of a number.
+func groupThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s, ""
+	if n := strings.Index(s, "."); n >= 0 {
+		whole, frac = s[:n], s[n:]
+	}
+	var b strings.Builder
+	for k, r := range whole {
+		if k > 0 && (len(whole)-k)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + frac
+}
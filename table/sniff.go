@@ -0,0 +1,478 @@
+package table
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings of the sources, as found by Sniff.
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+	Windows1256 = "windows-1256"
+)
+
+// sniffSize is the number of bytes at the start
+// of a source that Sniff examines.
+const sniffSize = 64 << 10
+
+// sniffLines is the number of lines examined
+// for the delimiter and the header.
+const sniffLines = 50
+
+// Sniffed is what Sniff found about a source.
+type Sniffed struct {
+	// Encoding is one of UTF8, UTF16LE, UTF16BE,
+	// Windows1252 or Windows1256.
+	Encoding string
+	// BOM is set if the source starts with a byte order mark.
+	BOM bool
+	// Delimiter separates the fields, ' ' for fields separated
+	// by runs of blanks, 0 if only the encoding was sniffed.
+	Delimiter rune
+	// Quote is the character that quotes the fields.
+	Quote rune
+	// Header is set if the first row names the columns.
+	Header bool
+}
+
+func (s Sniffed) String() string {
+	enc := s.Encoding
+	if s.BOM {
+		enc += " with BOM"
+	}
+	if s.Delimiter == 0 {
+		// only the encoding was sniffed
+		return enc
+	}
+	delim := fmt.Sprintf("%q delimited", s.Delimiter)
+	if s.Delimiter == ' ' {
+		delim = "whitespace separated"
+	}
+	header := "no header"
+	if s.Header {
+		header = "header"
+	}
+	return fmt.Sprintf("%s, %s, %q quoted, %s", enc, delim, s.Quote, header)
+}
+
+// Input returns the input that reads the source as sniffed.
+func (s Sniffed) Input(opt LineOptions) Input {
+	if s.Delimiter == ' ' {
+		return &Whitespace{LineOptions: opt}
+	}
+	return &Delimited{Comma: s.Delimiter, Quote: s.Quote, LineOptions: opt}
+}
+
+// Sniff examines the start of a source, as it is on disk, and
+// guesses its encoding, the delimiter and quote of its fields and
+// whether its first row is a header.
+func Sniff(sample []byte) Sniffed {
+	enc, bom := DetectEncoding(sample)
+	s := sniffAs(sample, enc, 0)
+	s.BOM = bom
+	return s
+}
+
+// sniffAs sniffs a sample in a known encoding,
+// past its first skip lines.
+func sniffAs(sample []byte, encoding string, skip int) Sniffed {
+	text, _ := ioutil.ReadAll(NewDecoder(bytes.NewReader(sample), encoding))
+	s := sniffText(text, skip, len(sample) >= sniffSize)
+	s.Encoding = encoding
+	return s
+}
+
+// DetectEncoding guesses the encoding of the start of a source: a
+// byte order mark settles it, zero bytes betray UTF-16 without one,
+// and text that is not UTF-8 is taken for windows-1256 if it has
+// words of Arabic letters, for windows-1252 otherwise.
+func DetectEncoding(sample []byte) (encoding string, bom bool) {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return UTF8, true
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return UTF16LE, true
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return UTF16BE, true
+	}
+
+	// ascii text in UTF-16 has every other byte zero
+	var zeros [2]int
+	for k, b := range sample {
+		if b == 0 {
+			zeros[k%2]++
+		}
+	}
+	switch n := len(sample) / 4; {
+	case n > 0 && zeros[1] > n && zeros[1] > 2*zeros[0]:
+		return UTF16LE, false
+	case n > 0 && zeros[0] > n && zeros[0] > 2*zeros[1]:
+		return UTF16BE, false
+	}
+
+	// the sample may end in the middle of a character, which
+	// is dropped, but a character that is whole is kept
+	if len(sample) >= sniffSize {
+		for k := len(sample) - 1; k >= 0 && k >= len(sample)-utf8.UTFMax; k-- {
+			if utf8.RuneStart(sample[k]) {
+				if !utf8.FullRune(sample[k:]) {
+					sample = sample[:k]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return UTF8, false
+	}
+	// Arabic words are runs of high bytes, accented
+	// latin names have a high byte here and there
+	high, inWords, run := 0, 0, 0
+	for _, b := range append(sample, ' ') {
+		if b >= 0x80 {
+			high++
+			run++
+			continue
+		}
+		if run >= 3 {
+			inWords += run
+		}
+		run = 0
+	}
+	if inWords*2 > high {
+		return Windows1256, false
+	}
+	return Windows1252, false
+}
+
+// NewDecoder returns a reader that converts r from
+// the encoding to UTF-8, without a byte order mark.
+// An unknown encoding is taken for UTF-8.
+func NewDecoder(r io.Reader, encoding string) io.Reader {
+	br := bufio.NewReader(r)
+	name, _ := encodingName(encoding)
+	switch name {
+	case UTF16LE:
+		return &utf16Reader{r: br, little: true}
+	case UTF16BE:
+		return &utf16Reader{r: br}
+	case Windows1252:
+		return &charmapReader{r: br, charmap: &windows1252}
+	case Windows1256:
+		return &charmapReader{r: br, charmap: &windows1256}
+	}
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+	return br
+}
+
+// encodingName returns the name of an encoding, as the constants
+// spell it, and whether it is one that NewDecoder converts.
+func encodingName(s string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", UTF8, "utf8":
+		return UTF8, true
+	case UTF16LE, "utf-16", "utf16", "ucs-2":
+		return UTF16LE, true
+	case UTF16BE:
+		return UTF16BE, true
+	case Windows1252, "cp1252", "latin1", "iso-8859-1":
+		return Windows1252, true
+	case Windows1256, "cp1256", "arabic":
+		return Windows1256, true
+	}
+	return UTF8, false
+}
+
+// utf16Reader converts UTF-16 to UTF-8.
+type utf16Reader struct {
+	r      *bufio.Reader
+	little bool
+	buf    []byte
+	start  bool
+}
+
+// unit reads a code unit.
+func (u *utf16Reader) unit() (uint16, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(u.r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	if u.little {
+		return uint16(b[0]) | uint16(b[1])<<8, nil
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.buf) < len(p) {
+		c, err := u.unit()
+		if err != nil {
+			if len(u.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		r := rune(c)
+		if utf16.IsSurrogate(r) {
+			c2, err := u.unit()
+			if err != nil {
+				r = utf8.RuneError
+			} else {
+				r = utf16.DecodeRune(r, rune(c2))
+			}
+		}
+		if !u.start {
+			u.start = true
+			if r == '\ufeff' { // byte order mark
+				continue
+			}
+		}
+		u.buf = appendRune(u.buf, r)
+	}
+	n := copy(p, u.buf)
+	u.buf = u.buf[n:]
+	return n, nil
+}
+
+func appendRune(b []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(b, buf[:n]...)
+}
+
+// charmapReader converts a single byte encoding to UTF-8.
+type charmapReader struct {
+	r       *bufio.Reader
+	charmap *[128]rune
+	buf     []byte
+}
+
+func (c *charmapReader) Read(p []byte) (int, error) {
+	for len(c.buf) < len(p) {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if len(c.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		if b < 0x80 {
+			c.buf = append(c.buf, b)
+		} else {
+			c.buf = appendRune(c.buf, c.charmap[b-0x80])
+		}
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// delimiters are the candidates of sniffText, the
+// first wins when several fit as well.
+var delimiters = []rune{'\t', ';', ',', '|'}
+
+// sniffText guesses the delimiter, quote and header of UTF-8 text,
+// past its first skip lines. If the text was cut short its last
+// line is left out.
+func sniffText(text []byte, skip int, short bool) Sniffed {
+	lines := strings.Split(string(text), "\n")
+	if short && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+	var sample []string
+	for _, l := range lines {
+		if l = strings.TrimRight(l, "\r"); strings.TrimSpace(l) == "" {
+			continue
+		} else if skip > 0 {
+			skip--
+			continue
+		}
+		sample = append(sample, l)
+		if len(sample) == sniffLines {
+			break
+		}
+	}
+
+	s := Sniffed{Encoding: UTF8, Delimiter: ',', Quote: sniffQuote(sample)}
+	best := 0.0
+	for _, d := range delimiters {
+		if score := consistency(sample, func(l string) int { return countOutside(l, d, s.Quote) }); score > best {
+			s.Delimiter, best = d, score
+		}
+	}
+	if best < 0.5 && consistency(sample, func(l string) int { return len(strings.Fields(l)) - 1 }) >= 0.8 {
+		s.Delimiter = ' '
+	}
+	s.Header = sniffHeader(strings.Join(sample, "\n"), s.Input(LineOptions{}))
+	return s
+}
+
+// consistency returns the share of the lines that have the most
+// common number of fields, zero if they have but one field.
+func consistency(lines []string, count func(string) int) float64 {
+	freq := map[int]int{}
+	mode := 0
+	for _, l := range lines {
+		n := count(l)
+		freq[n]++
+		if freq[n] > freq[mode] || freq[n] == freq[mode] && n > mode {
+			mode = n
+		}
+	}
+	if mode == 0 || len(lines) == 0 {
+		return 0
+	}
+	return float64(freq[mode]) / float64(len(lines))
+}
+
+// countOutside counts the delimiters outside quotes.
+func countOutside(line string, delim, quote rune) int {
+	n := 0
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == quote:
+			quoted = !quoted
+		case r == delim && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// sniffQuote returns the character that opens and closes
+// fields: double quotes, or single quotes if they are
+// met more often at the edges of the fields.
+func sniffQuote(lines []string) rune {
+	edges := func(q rune) int {
+		n := 0
+		for _, l := range lines {
+			rs := []rune(l)
+			for k, r := range rs {
+				if r != q {
+					continue
+				}
+				before := k == 0 || strings.ContainsRune("\t;,|", rs[k-1])
+				after := k == len(rs)-1 || strings.ContainsRune("\t;,|", rs[k+1])
+				if before || after {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	if edges('\'') > edges('"') {
+		return '\''
+	}
+	return '"'
+}
+
+// sniffHeader decides whether the first record of the text is a
+// header. Every column votes: a header names a column of numbers or
+// dates with text. Without votes the first row is a header if its
+// cells are all filled, different and not numbers.
+func sniffHeader(text string, in Input) bool {
+	rd := in.Open(strings.NewReader(text))
+	first, err := rd.Read()
+	if err != nil {
+		return false
+	}
+	var rest [][]string
+	for len(rest) < sniffLines {
+		record, err := rd.Read()
+		if err != nil {
+			break
+		}
+		rest = append(rest, record)
+	}
+
+	votes := 0
+	for k, v := range first {
+		var c Column
+		for _, record := range rest {
+			if k < len(record) {
+				c.Add(record[k])
+			}
+		}
+		typ := c.Resolve()
+		head := DetectType(strings.TrimSpace(v))
+		switch {
+		case typ.Numeric() || typ == DateCell:
+			if head.Numeric() || head == DateCell {
+				votes--
+			} else {
+				votes++
+			}
+		case head.Numeric():
+			votes--
+		}
+	}
+	if votes != 0 {
+		return votes > 0
+	}
+	seen := map[string]bool{}
+	for _, v := range first {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] || DetectType(v).Numeric() {
+			return false
+		}
+		seen[v] = true
+	}
+	return len(first) > 0 && len(rest) > 0
+}
+
+// Auto reads sources of unknown format: the delimiter and the quote
+// are sniffed from the first lines when the source is opened, unless
+// the table sniffed them already. A table with an Auto input also
+// takes the first row for a header if it looks like one, see
+// Table.Sniffed and Table.HeaderMode.
+type Auto struct {
+	LineOptions
+}
+
+// Open sniffs r and returns a reader of its records.
+func (a *Auto) Open(r io.Reader) RecordReader {
+	br := bufio.NewReaderSize(r, sniffSize)
+	sample, _ := br.Peek(sniffSize)
+	return sniffText(sample, 0, len(sample) >= sniffSize).Input(a.LineOptions).Open(br)
+}
+
+// decode returns a reader of r converted to UTF-8, from t.Encoding
+// or, if it is empty, from the encoding sniffed. What was found is
+// kept in t.Sniffed, which an Auto input reads the source with.
+func (t *Table) decode(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	sample, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	enc, bom := DetectEncoding(sample)
+	if t.Encoding != "" {
+		var ok bool
+		if enc, ok = encodingName(t.Encoding); !ok {
+			return nil, fmt.Errorf("unknown encoding %q, use utf-8, utf-16le, utf-16be, windows-1252 or windows-1256", t.Encoding)
+		}
+	}
+	if _, ok := t.Input.(*JSON); ok {
+		// json has neither delimiters nor quotes to sniff
+		t.Sniffed = Sniffed{Encoding: enc}
+	} else {
+		t.Sniffed = sniffAs(sample, enc, t.SkipN)
+	}
+	t.Sniffed.BOM = bom
+	return NewDecoder(br, enc), nil
+}
@@ -0,0 +1,73 @@
+package table
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes encodes s in UTF-16, little or big endian.
+func utf16Bytes(s string, little bool) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if little {
+			b = append(b, byte(u), byte(u>>8))
+		} else {
+			b = append(b, byte(u>>8), byte(u))
+		}
+	}
+	return b
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []byte
+		enc    string
+		bom    bool
+	}{
+		{"ascii", []byte("code,qty\n1,2\n"), UTF8, false},
+		{"utf-8", []byte("name\nMüller\nمحمد\n"), UTF8, false},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFcode,qty\n"), UTF8, true},
+		{"utf-16le bom", append([]byte{0xFF, 0xFE}, utf16Bytes("code,qty\n", true)...), UTF16LE, true},
+		{"utf-16be bom", append([]byte{0xFE, 0xFF}, utf16Bytes("code,qty\n", false)...), UTF16BE, true},
+		{"utf-16le", utf16Bytes("code,qty\n1,2\n", true), UTF16LE, false},
+		{"utf-16be", utf16Bytes("code,qty\n1,2\n", false), UTF16BE, false},
+		{"windows-1252", []byte("name\nCaf\xe9 M\xfcller\n"), Windows1252, false},
+		// محمد,علي in windows-1256
+		{"windows-1256", []byte("name\n\xe3\xcd\xe3\xcf,\xda\xe1\xed\n"), Windows1256, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, bom := DetectEncoding(tt.sample)
+			if enc != tt.enc || bom != tt.bom {
+				t.Errorf("DetectEncoding = %s, %v, want %s, %v", enc, bom, tt.enc, tt.bom)
+			}
+		})
+	}
+}
+
+// TestDetectEncodingCut sniffs UTF-8 sources larger than the sample,
+// which cuts them at every place in characters of two, three and
+// four bytes.
+func TestDetectEncodingCut(t *testing.T) {
+	line := "1,محمد €😀\n"
+	for pad := 0; pad < len(line); pad++ {
+		src := strings.Repeat(" ", pad) + "id,name\n" + strings.Repeat(line, 80<<10/len(line))
+		if len(src) <= sniffSize {
+			t.Fatalf("the source of %d bytes fits the sample", len(src))
+		}
+		if enc, _ := DetectEncoding([]byte(src)[:sniffSize]); enc != UTF8 {
+			t.Errorf("pad %d: DetectEncoding = %s, want %s", pad, enc, UTF8)
+		}
+		tb := New()
+		raw, err := tb.CleanReader(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tb.Sniffed.Encoding != UTF8 || !bytes.Contains(raw, []byte("محمد")) {
+			t.Errorf("pad %d: read as %s, the names are garbled", pad, tb.Sniffed.Encoding)
+		}
+	}
+}
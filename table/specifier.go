@@ -0,0 +1,297 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CellType is the type of the contents of a cell. When it
+// refers to a column it is the dominant type of its cells.
+type CellType int
+
+// Cell types detected by DetectType.
+const (
+	EmptyCell CellType = iota
+	IntegerCell
+	DecimalCell
+	CurrencyCell
+	DateCell
+	CodeCell
+	TextCell
+	ErrorCell
+)
+
+var cellTypeNames = []string{"empty", "integer", "decimal", "currency", "date", "code", "text", "error"}
+
+func (c CellType) String() string {
+	if int(c) < len(cellTypeNames) {
+		return cellTypeNames[c]
+	}
+	return "unknown"
+}
+
+// Numeric reports whether the type holds a number.
+func (c CellType) Numeric() bool {
+	return c == IntegerCell || c == DecimalCell || c == CurrencyCell
+}
+
+// Cells wider than longText runes are typeset in a paragraph
+// column. Codes are short strings without any spaces.
+const (
+	longText = 30
+	codeLen  = 16
+	// the longest date the layouts accept, "Sep 12, 2006"
+	maxDateLen = 12
+)
+
+var (
+	numberPattern = regexp.MustCompile(`^[-+]?(\d{1,3}(,\d{3})+|\d+)?(\.\d+)?([eE][-+]?\d+)?$`)
+	// currency markers that can precede or follow an amount
+	currencySymbols = []string{"QAR", "QR", "USD", "EUR", "GBP", "$", "€", "£"}
+	// date layouts most commonly met in excel exports
+	dateLayouts = []string{
+		"2006-01-02", "02/01/2006", "2/1/2006", "01/02/06",
+		"02-Jan-2006", "2-Jan-06", "02-Jan-06", "Jan 2, 2006", "2 Jan 2006",
+	}
+)
+
+// isNumber reports if s is a plain number, optionally
+// signed and with grouping commas.
+func isNumber(s string) bool {
+	if s == "" || s == "-" || s == "+" || s == "." {
+		return false
+	}
+	return numberPattern.MatchString(s)
+}
+
+// trimCurrency strips a currency marker from s. It returns
+// false if no marker was found.
+func trimCurrency(s string) (string, bool) {
+	for _, c := range currencySymbols {
+		if strings.HasPrefix(s, c) {
+			return strings.TrimSpace(strings.TrimPrefix(s, c)), true
+		}
+		if strings.HasSuffix(s, c) {
+			return strings.TrimSpace(strings.TrimSuffix(s, c)), true
+		}
+	}
+	return s, false
+}
+
+// DetectType guesses the type of a single cell.
+func DetectType(s string) CellType {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return EmptyCell
+	case isNumber(s):
+		if strings.ContainsAny(s, ".eE") {
+			return DecimalCell
+		}
+		return IntegerCell
+	}
+	if v, ok := trimCurrency(s); ok && isNumber(v) {
+		return CurrencyCell
+	}
+	if _, ok := parseDate(s); ok {
+		return DateCell
+	}
+	if !strings.ContainsAny(s, " \t") && utf8.RuneCountInString(s) <= codeLen {
+		return CodeCell
+	}
+	return TextCell
+}
+
+// Column holds what has been learned about a column
+// by looking at all of its cells.
+type Column struct {
+	// Index is the position of the column in the source.
+	Index int
+	// Name is the heading of the column in the source, if any.
+	Name string
+	// Type is the dominant cell type of the column.
+	Type CellType
+	// Width is the widest cell in runes.
+	Width int
+	// Digits before and after the decimal marker, used
+	// to build a siunitx table-format.
+	IntDigits, Decimals int
+	Signed              bool
+	// Raw is set on the columns of raw LaTeX, not escaped.
+	Raw bool
+
+	counts [ErrorCell + 1]int
+}
+
+// Add accounts for a cell of the column.
+func (c *Column) Add(s string) {
+	c.add(DetectType(s), s)
+}
+
+// add accounts for a cell whose type is already known.
+func (c *Column) add(typ CellType, s string) {
+	s = strings.TrimSpace(s)
+	c.counts[typ]++
+	if n := utf8.RuneCountInString(s); n > c.Width {
+		c.Width = n
+	}
+	if !typ.Numeric() {
+		return
+	}
+	if v, ok := trimCurrency(s); ok {
+		s = v
+	}
+	if strings.HasPrefix(s, "-") {
+		c.Signed = true
+	}
+	s = strings.TrimLeft(s, "-+")
+	s = strings.Replace(s, ",", "", -1)
+	if n := strings.IndexAny(s, "eE"); n >= 0 {
+		s = s[:n]
+	}
+	whole, frac := s, ""
+	if n := strings.Index(s, "."); n >= 0 {
+		whole, frac = s[:n], s[n+1:]
+	}
+	if len(whole) > c.IntDigits {
+		c.IntDigits = len(whole)
+	}
+	if len(frac) > c.Decimals {
+		c.Decimals = len(frac)
+	}
+}
+
+// Resolve sets the dominant type of the column. Numeric types are
+// counted together, so that a column of amounts with a few integers
+// is still a column of amounts.
+func (c *Column) Resolve() CellType {
+	numeric := c.counts[IntegerCell] + c.counts[DecimalCell] + c.counts[CurrencyCell]
+	c.Type = EmptyCell
+	best := 0
+	for typ := DateCell; typ <= TextCell; typ++ {
+		if c.counts[typ] > best {
+			best = c.counts[typ]
+			c.Type = typ
+		}
+	}
+	if numeric > 0 && numeric >= best {
+		switch {
+		case c.counts[CurrencyCell] > 0:
+			c.Type = CurrencyCell
+		case c.counts[DecimalCell] > 0:
+			c.Type = DecimalCell
+		default:
+			c.Type = IntegerCell
+		}
+	}
+	return c.Type
+}
+
+// Specifier returns the tabular column type for the column.
+// Numbers are right aligned, or use a siunitx S column if sicolumns
+// is true. Long text is wrapped in a paragraph column, or an X column
+// if the table is a tabularx. Codes and dates are left aligned
+// or centred if they are very short.
+func (c Column) Specifier(sicolumns, tabularx bool) string {
+	switch c.Type {
+	case IntegerCell, DecimalCell:
+		if sicolumns {
+			sign := ""
+			if c.Signed {
+				sign = "-"
+			}
+			digits := c.IntDigits
+			if digits == 0 {
+				digits = 1
+			}
+			return fmt.Sprintf("S[table-format=%s%d.%d]", sign, digits, c.Decimals)
+		}
+		return "r"
+	case CurrencyCell:
+		return "r"
+	case DateCell:
+		return "c"
+	case CodeCell:
+		if c.Width <= 3 {
+			return "c"
+		}
+		return "l"
+	case TextCell:
+		if c.Width <= longText {
+			return "l"
+		}
+		if tabularx {
+			return `>{\RaggedRight}X`
+		}
+		return `>{\RaggedRight}p{` + textWidth(c.Width) + `}`
+	}
+	return "l"
+}
+
+// Align returns the alignment of the column, 'l', 'c' or 'r', the
+// same Specifier chooses, for the formats that have no specifier.
+func (c Column) Align() byte {
+	switch s := c.Specifier(false, false); s {
+	case "r", "c":
+		return s[0]
+	}
+	return 'l'
+}
+
+// textWidth estimates the width of a paragraph column
+// from the number of characters in its widest cell.
+func textWidth(n int) string {
+	cm := float64(n) * 0.15
+	if cm < 2 {
+		cm = 2
+	}
+	if cm > 6 {
+		cm = 6
+	}
+	return strconv.FormatFloat(cm, 'f', 1, 64) + "cm"
+}
+
+// InferSpecifier builds a tabular specifier from the columns. The
+// columns are separated by vertical rules as in the rest of the
+// tables we produce. Setting the property "siunitx" to "true" typesets
+// numbers in S columns.
+func (t *Table) InferSpecifier(cols []Column) string {
+	var buf bytes.Buffer
+	tabularx := t.Type == "tabularx"
+	if tabularx {
+		buf.WriteString(`{\linewidth}`)
+	}
+	buf.WriteString("{|")
+	for _, c := range cols {
+		buf.WriteString(c.Specifier(t.prop["siunitx"] == "true", tabularx) + "|")
+	}
+	buf.WriteString("}%")
+	return buf.String()
+}
+
+// Specifier returns the user supplied specifier if there is
+// one, otherwise the one inferred from the data.
+func (t *Table) Specifier(prop map[string]string) string {
+	if s := prop["specifier"]; s != "" {
+		return s
+	}
+	return t.InferSpecifier(t.pickColumns())
+}
+
+// sColumn reports if the k-th selected column is typeset as an
+// siunitx S column. Such cells must hold the bare number.
+func (t *Table) sColumn(k int) bool {
+	if t.prop["specifier"] != "" || t.prop["siunitx"] != "true" {
+		return false
+	}
+	cols := t.pickColumns()
+	if k >= len(cols) {
+		return false
+	}
+	typ := cols[k].Type
+	return typ == IntegerCell || typ == DecimalCell
+}
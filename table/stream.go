@@ -0,0 +1,217 @@
+package table
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// sampleRows is the number of rows examined when streaming
+// if t.SampleRows is zero.
+const sampleRows = 1000
+
+// cleaner cleans its input line by line, as Clean
+// cleans a whole file.
+type cleaner struct {
+	r   *bufio.Reader
+	buf []byte
+	err error
+}
+
+// NewCleaner returns a reader that performs the replacements of
+// Clean on the fly, holding a single line in memory.
+func NewCleaner(r io.Reader) io.Reader {
+	return &cleaner{r: bufio.NewReader(r)}
+}
+
+func (c *cleaner) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		var line []byte
+		line, c.err = c.r.ReadBytes('\n')
+		c.buf = CleanBytes(line)
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// buffered is implemented by the renderers that hold the
+// whole table before they write it.
+type buffered interface {
+	buffered()
+}
+
+func (l *layout) buffered() {}
+
+// stream starts a streaming rendering. It reads the head and the
+// first SampleRows rows, to learn the columns from them, and returns
+// an iterator over all the rows that reads the rest as it goes.
+func (t *Table) stream(r io.Reader, prop map[string]string) (rowIterator, error) {
+	t.prop = prop
+	t.Type = prop["type"]
+	if _, ok := t.renderer().(buffered); ok {
+		return nil, errNotStreaming
+	}
+
+	if !t.isBinary() {
+		dec, err := t.decode(r)
+		if err != nil {
+			return nil, err
+		}
+		r = NewCleaner(dec)
+	}
+	names, err := t.open(r)
+	if err != nil {
+		return nil, err
+	}
+	n := t.SampleRows
+	if n <= 0 {
+		n = sampleRows
+	}
+	var sample [][]Field
+	var lines []int
+	for len(sample) < n {
+		row, line, err := t.readRow(names)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		sample = append(sample, row)
+		lines = append(lines, line)
+	}
+	if err := t.examine(names, sample); err != nil {
+		return nil, err
+	}
+
+	// the columns already reported for a cell that does not fit
+	drifted := map[int]bool{}
+	return func() ([]Field, int, error) {
+		if len(sample) > 0 {
+			row, line := sample[0], lines[0]
+			sample, lines = sample[1:], lines[1:]
+			return row, line, nil
+		}
+		row, line, err := t.readRow(names)
+		if err == nil {
+			t.nrows++
+			t.checkTypes(row, line, drifted)
+		}
+		return row, line, err
+	}, nil
+}
+
+// checkTypes reports the cells of a row read after the sample that
+// do not fit the type learned for their column, as a text in a column
+// of amounts, which the specifier typesets wrongly. Each column is
+// reported once, at the first such cell.
+func (t *Table) checkTypes(row []Field, line int, drifted map[int]bool) {
+	selected := t.selector
+	if len(selected) == 0 {
+		selected = make([]int, len(row))
+		for k := range selected {
+			selected[k] = k
+		}
+	}
+	for _, k := range selected {
+		if k >= len(row) || k >= len(t.columns) || drifted[k] {
+			continue
+		}
+		c, f := t.columns[k], row[k]
+		if fits(c, f) {
+			continue
+		}
+		drifted[k] = true
+		t.warn(&RecordError{File: t.inpath, Line: line, Column: k,
+			Err: fmt.Errorf("%w: %s cell %q in a %s column", ErrTypeMismatch, f.t, strings.TrimSpace(f.Value), c.Type)})
+	}
+}
+
+// fits reports if a cell can be typeset with the
+// specifier of a column learned from other cells.
+func fits(c Column, f Field) bool {
+	switch {
+	case f.t == EmptyCell || f.t == ErrorCell || c.Raw:
+		return true
+	case c.Type.Numeric():
+		// amounts hold integers, decimals hold integers
+		return f.t.Numeric() && f.t <= c.Type
+	case c.Type == DateCell:
+		return f.t == DateCell
+	case c.Type == CodeCell || c.Type == TextCell:
+		// long text overflows a column that is not a paragraph
+		return c.Width > longText || utf8.RuneCountInString(strings.TrimSpace(f.Value)) <= longText
+	}
+	return true
+}
+
+// Stream renders a table as Render does, but row by row with
+// bounded memory, for exports too large to hold. The input is the
+// raw csv, converted to UTF-8 and cleaned on the fly. The column
+// types, and with them the specifier, are learned from the first
+// SampleRows rows; a later cell that does not fit the type of its
+// column is reported in Diagnostics as ErrTypeMismatch.
+// Totals are kept as running sums. The markdown and text
+// renderers need the whole table and cannot stream.
+func (t *Table) Stream(out io.Writer, r io.Reader, prop map[string]string) error {
+	next, err := t.stream(r, prop)
+	if err != nil {
+		return t.fail(err)
+	}
+	return t.fail(t.renderRows(out, next))
+}
+
+// StreamSections renders a table as RenderSections
+// does, but row by row as Stream.
+func (t *Table) StreamSections(out io.Writer, r io.Reader, prop map[string]string) error {
+	next, err := t.stream(r, prop)
+	if err != nil {
+		return t.fail(err)
+	}
+	return t.fail(t.renderSections(out, next))
+}
+
+// StreamCSV streams the csv file in to the file out, as ReadCSV
+// would render it. The output is written to a temporary file
+// renamed when the rendering succeeds.
+func (t *Table) StreamCSV(in, out string, summation bool, prop map[string]string) error {
+	return t.streamFile(in, out, summation, func(w io.Writer, r io.Reader) error {
+		return t.Stream(w, r, prop)
+	})
+}
+
+// StreamSectionCSV streams the csv file in to the
+// file out, as SectionCSV would render it.
+func (t *Table) StreamSectionCSV(in, out string, summation bool, prop map[string]string) error {
+	return t.streamFile(in, out, summation, func(w io.Writer, r io.Reader) error {
+		return t.StreamSections(w, r, prop)
+	})
+}
+
+// streamFile renders the file in to the file out.
+func (t *Table) streamFile(in, out string, summation bool, render func(w io.Writer, r io.Reader) error) error {
+	t.inpath = in
+	t.summation = summation
+	defer func() { t.summation = false }()
+
+	// the hash goes in the banner, before the rows are read
+	hash, err := hashFile(in)
+	if err != nil {
+		return t.fail(err)
+	}
+	t.inhash = hash
+	f, err := os.Open(in)
+	if err != nil {
+		return t.fail(err)
+	}
+	defer f.Close()
+	return t.fail(replaceFile(out, func(w io.Writer) error {
+		return render(w, f)
+	}))
+}
@@ -0,0 +1,101 @@
+package table
+
+import (
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// rowsReader generates a csv of n rows without holding it, and
+// samples the heap as it goes to find the peak of a streaming.
+type rowsReader struct {
+	n, i int
+	buf  []byte
+	peak uint64
+}
+
+func (r *rowsReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		switch {
+		case r.i > r.n:
+			return 0, io.EOF
+		case r.i == 0:
+			r.buf = []byte("code,item,qty,amount\n")
+		default:
+			r.buf = []byte(strconv.Itoa(r.i) + ",Item " + strconv.Itoa(r.i%97) + "," +
+				strconv.Itoa(r.i%13) + "," + strconv.Itoa(r.i%1000) + ".50\n")
+		}
+		if r.i%10000 == 0 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > r.peak {
+				r.peak = m.HeapAlloc
+			}
+		}
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// streamPeak streams a table of n rows and returns the peak of the heap.
+func streamPeak(n int) (uint64, error) {
+	runtime.GC()
+	t := New()
+	t.HasHeader = true
+	r := &rowsReader{n: n}
+	err := t.Stream(ioutil.Discard, r, map[string]string{"type": "longtable"})
+	return r.peak, err
+}
+
+// TestStreamHeap fails if the heap of a streaming grows with the rows:
+// a million rows may take twice the peak of ten thousand, and the few
+// megabytes the collector lets the garbage reach before it runs.
+func TestStreamHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams a million rows")
+	}
+	small, err := streamPeak(10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := streamPeak(1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := 2*small + 8<<20; large > limit {
+		t.Errorf("peak heap %d bytes for 1M rows, %d for 10k, want at most %d", large, small, limit)
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		rows int
+	}{
+		{"10k", 10000},
+		{"1M", 1000000},
+		{"3M", 3000000},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				t := New()
+				t.HasHeader = true
+				r := &rowsReader{n: bm.rows}
+				if err := t.Stream(ioutil.Discard, r, map[string]string{"type": "longtable"}); err != nil {
+					b.Fatal(err)
+				}
+				if r.peak > peak {
+					peak = r.peak
+				}
+			}
+			// the peak stays flat from 10k to 1M rows
+			b.ReportMetric(float64(peak), "peak-heap-B")
+		})
+	}
+}
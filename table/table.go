@@ -6,7 +6,8 @@ package table
 import (
 	"bufio"
 	"bytes"
-	"encoding/csv"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -15,13 +16,17 @@ import (
 	"ml/rules"
 	"ml/table/caption"
 	"os"
-	"reflect"
-	"stampcircles/is"
+	"path/filepath"
+	"regexp"
 	"stampcircles/util"
 	"strconv"
 	"strings"
 )
 
+// Version is the version of the package, written in the
+// banner of the tables.
+const Version = "0.20"
+
 const (
 	cr      = "\\\\"
 	nl      = "\n"
@@ -30,19 +35,80 @@ const (
 
 // Errors returned by Table
 var (
-	errInvalidFieldNames = errors.New("That was a fatal error my friend")
-	errInvalidRange      = errors.New("The provided range in SelectColumns() is invalid, my friend")
+	errInvalidFieldNames = errors.New("invalid column selection")
+	errInvalidRange      = errors.New("column out of range")
+	// ErrUnknownColumn and ErrAmbiguousColumn are returned when a
+	// selected name matches none or more than one of the columns.
+	ErrUnknownColumn   = errors.New("unknown column")
+	ErrAmbiguousColumn = errors.New("ambiguous column")
+	// ErrShortRecord is returned, wrapped in a RecordError, when a
+	// record does not have one of the selected columns.
+	ErrShortRecord = errors.New("record is too short for the selected columns")
+	errNoInput     = errors.New("there is nothing to render, call Clean first")
+	// ErrUnsafeTeX is reported, wrapped in a RecordError, for
+	// the LaTeX neutralised in safe mode.
+	ErrUnsafeTeX = errors.New("unsafe TeX neutralised")
+	// ErrSpreadsheetError is reported, wrapped in a RecordError,
+	// for every error value of the spreadsheet, #N/A and the like.
+	ErrSpreadsheetError = errors.New("spreadsheet error")
+	// ErrUnknownSheet is returned when the sheet of a
+	// workbook to read is not found.
+	ErrUnknownSheet = errors.New("unknown sheet")
+	// ErrTooManyCells is returned when the rows and columns a
+	// spreadsheet repeats expand to more cells than can be read.
+	ErrTooManyCells = errors.New("too many cells")
+	// ErrNotObject is reported, wrapped in a RecordError, for the
+	// records of a json source that are not objects.
+	ErrNotObject = errors.New("json record is not an object")
+	// ErrTypeMismatch is reported, wrapped in a RecordError, for
+	// the cells of a streamed table that do not fit the type learned
+	// for their column from the first rows.
+	ErrTypeMismatch = errors.New("cell does not fit the column type")
+	// errNotStreaming is returned when streaming with
+	// a renderer that holds the whole table.
+	errNotStreaming = errors.New("the renderer needs the whole table and cannot stream")
 )
 
-// Field represent a cell of a table.
-type Field struct {
-	Name string
-	t    string
+// RecordError reports an error in a record of the source
+// together with the position where it happened.
+type RecordError struct {
+	// File is the source file, if known.
+	File string
+	// Line is the line of the record in the file, starting at 1.
+	Line int
+	// Column is the index of the offending column or -1
+	// if the error is not about a single column.
+	Column int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	var buf bytes.Buffer
+	if e.File != "" {
+		buf.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		buf.WriteString(strconv.Itoa(e.Line) + ":")
+	}
+	if e.Column >= 0 {
+		buf.WriteString(" column " + strconv.Itoa(e.Column) + ":")
+	}
+	if buf.Len() > 0 {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(e.Err.Error())
+	return buf.String()
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
 }
 
 // Trigger is used to trigger subheadings in a longtable.
+// Each project keeps its own vocabulary in the Rules, see Rule.
 type Trigger struct {
 	Names map[int][]string
+	Rules []Rule
 }
 
 // Stripe is a struct used to add evn and odd column colors.
@@ -84,45 +150,95 @@ type Table struct {
 	Raw []byte
 	// data holds the table as read
 	// from the reader and after a clean
-	// operation.
-	data [][]string
+	// operation, as rows of typed cells.
+	data [][]Field
+	// header rows read from the source
+	headRows [][]string
+	// whether the source read has a header, and its rows
+	header    bool
+	headLines int
+	// line in the source of every row in data
+	lines []int
 	// number of columns
 	ncols int
 	// number of rows
 	nrows int
 	// the source file path
-	fields []Field
 	inpath string
-	// path for saved cleaned file
-	outpath string
+	// the sha256 of the source
+	inhash string
 	// the name of the table compiled to TeX
-	texfile  string
-	Err      error
-	Notes    []string
-	Type     string
-	property string
+	texfile string
+	// Err holds the error that stopped the last rendering.
+	Err error
+	// Diagnostics collects the problems of the last rendering that
+	// were not fatal, such as lines the csv reader could not parse.
+	// It keeps the first MaxDiagnostics, 1000 if zero, and counts the
+	// others in DroppedDiagnostics, so that a streamed file with many
+	// bad rows does not fill the memory.
+	Diagnostics        []error
+	MaxDiagnostics     int
+	DroppedDiagnostics int
+	Notes              []string
+	Type               string
+	property           string
 	// rendering properties
 	prop map[string]string
 
 	// slice with selected cells
 	selector []int
+	// metadata of every column of the source,
+	// used when no specifier is provided
+	columns []Column
 
 	//
 	selectedColumns []interface{}
+	// source columns of raw LaTeX
+	rawColumns []interface{}
+	// Safe is for the csv files that cannot be trusted. The raw
+	// columns are then neutralised: no control sequence of the data
+	// but SafeCommands reaches the output, and what was neutralised
+	// is reported in Diagnostics. The other cells are always escaped.
+	Safe bool
+	// SafeCommands are the control words allowed in safe mode,
+	// DefaultSafeCommands if nil.
+	SafeCommands []string
+	// line in the source of the row being rendered
+	line int
+	// ErrorValues is what becomes of the error values of the
+	// spreadsheet, #DIV/0!, #N/A and the like. They are shown as
+	// a dash by default, and always reported in Diagnostics.
+	ErrorValues ErrorPolicy
 
 	// number of first lines to skip
 	SkipN int
+	// SampleRows is the number of rows examined to learn the
+	// columns when streaming, 1000 if zero.
+	SampleRows int
 	// Tables can have section names, these are being picked up
 	// and used as subtitles. Defaults to false.
 	Header          Head //[][]string
 	HasHeader       bool
 	HasManualHeader bool
 	HeaderLines     int
+	HeaderMode      HeaderMode
 
 	HasSections bool
-	w           *bufio.Writer
-	rd          *csv.Reader
-	Labels      []string
+	// SectionTitles maps the codes that open a section to
+	// their titles. If nil the code is used as the title.
+	SectionTitles *SectionTitles
+	w             *bufio.Writer
+	rd            RecordReader
+	// Input reads the records of the source, a csv
+	// file if nil. See NewInput.
+	Input Input
+	// Encoding is the encoding of the source, sniffed if empty.
+	// The source is converted to UTF-8 before it is cleaned.
+	Encoding string
+	// Sniffed is what was found about the last source read. To
+	// override a guess set Encoding, Input or HeaderMode yourself.
+	Sniffed Sniffed
+	Labels  []string
 	// Triggers will use the key of the map to trigger actions in cells or rows
 	// for example the word subtotal can provide a signal to the processor
 	// that the row is special and should use a multicolumn.
@@ -134,9 +250,23 @@ type Table struct {
 	// Prints a rule if true and we have an empty line
 	EmptyToLine bool
 
+	// Totals computed by the package. The summation argument
+	// of ReadCSV and SectionCSV switches them on.
+	Totals    Totals
+	summation bool
+
+	// Audit verifies the subtotal rows of the spreadsheet, the
+	// ones that do not add up are kept in Mismatches.
+	Audit      Audit
+	Mismatches []Mismatch
+
 	// Captions
 	caption.CaptionStyle
 
+	// Renderer typesets the table. If nil the table is
+	// typeset in LaTeX.
+	Renderer Renderer
+
 	Index     bool
 	Landscape bool
 	// cell level
@@ -180,7 +310,7 @@ type Table struct {
 
 // New creates a new refernce to a Table.
 func New() *Table {
-	return &Table{fields: []Field{},
+	return &Table{
 		HasSections: false,
 		HasHeader:   false,
 		HeaderLines: 1,
@@ -192,108 +322,237 @@ func New() *Table {
 // Columns selects the columns to be used.
 func (t *Table) Columns(ss []int) {
 	t.selector = []int(ss)
+	t.selectedColumns = nil
 	t.ncols = len(ss)
 }
 
-// checkRange checks if a string is a valid range
-// of integers. If it is it returns a slice with
-// the integers.
-func checkRange(str string) ([]int, bool, error) {
-	var intRange []int
-	n := strings.Index(str, "-")
-	if n > 0 {
-		start, err := strconv.Atoi(str[:n])
-		end, err := strconv.Atoi(str[n+1:])
-		if err != nil {
-			return intRange, false, errInvalidFieldNames
-		}
-		for i := start; i < end+1; i++ {
-			intRange = append(intRange, i)
-		}
-		return intRange, true, nil
+// columnNames returns the names a selection is resolved against, the
+// header row of the source. The manual header labels the selected
+// columns, not those of the source, and is never used.
+func (t *Table) columnNames() []string {
+	if len(t.headRows) > 0 {
+		return t.headRows[0]
 	}
-	return intRange, false, nil
+	return nil
 }
 
-// validateSelectedColumns, validates the
-// user provided selection for errors.
-// Valid selections are either all integers or
-// all strings. User can also provide ranges
-// as "3-5", which selects columns 3-5 inclusive.
-func (t *Table) validateSelectedColumns(s ...interface{}) error {
-	var intRange []int
-	strRange := make([]string, 0)
+// ColumnsByName selects columns by their name. Names can be mixed
+// with indices and ranges of the source columns:
+//
+//	r.ColumnsByName("code", 1, "5-6", "C:F", "/^QTY/", "!notes")
+//
+// A name is first looked up exactly in the header row, then ignoring
+// case with underscores taken as spaces. "5-6" selects the columns 5
+// to 6 inclusive and "C:F" the spreadsheet columns C to F. A regular
+// expression between slashes selects every column whose name matches.
+// A selector prefixed with ! excludes its columns; if all selectors
+// are exclusions they apply to all the columns.
+//
+// The selection is resolved when the table is loaded and the header
+// is known. It replaces any selection made with Columns.
+func (t *Table) ColumnsByName(s ...interface{}) {
+	if len(s) < 1 {
+		panic("Error you need to select at least 1 column")
+	}
 
+	// We have input from the user save it n struct.
+	// We will validate later, when we start reading the csv
+	// file and we know the number of cells.
+	t.selectedColumns = append(t.selectedColumns, s...)
+
+}
+
+// GetColumns resolves the columns selected with ColumnsByName against
+// the header of the table and returns their indices. Unknown and
+// ambiguous names are reported as ErrUnknownColumn and
+// ErrAmbiguousColumn.
+func (t *Table) GetColumns() ([]int, error) {
+	return selectColumns(t.columnNames(), t.ncols, t.selectedColumns...)
+}
+
+// selectColumns resolves a selection against the names
+// of a table with ncols columns.
+func selectColumns(names []string, ncols int, s ...interface{}) ([]int, error) {
+	var include, exclude []int
+	exclusive := true
 	for _, v := range s {
-		value := reflect.ValueOf(v)
-		switch value.Kind() {
-		case reflect.String:
-			str := value.String()
-			iRange, ok, _ := checkRange(str)
-			if ok {
-				intRange = append(intRange, iRange...)
-				fmt.Println(intRange, iRange)
-			} else {
-				strRange = append(strRange, str)
+		var cols []int
+		var err error
+		negate := false
+		switch v := v.(type) {
+		case int:
+			cols, err = columnIndex(v, ncols)
+		case string:
+			sel := strings.TrimSpace(v)
+			if strings.HasPrefix(sel, "!") {
+				negate = true
+				sel = strings.TrimSpace(sel[1:])
 			}
-
-		//return ErrInvalidFieldNames
-		case reflect.Int:
-			intRange = append(intRange, int(value.Int()))
+			cols, err = resolveColumn(sel, names, ncols)
 		default:
-			return errInvalidFieldNames
+			err = fmt.Errorf("%w: %v is a %T, use a name or an index", errInvalidFieldNames, v, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			exclude = append(exclude, cols...)
+		} else {
+			include = append(include, cols...)
+			exclusive = false
 		}
 	}
 
-	// invalid conditions or maybe allowed?
-	if len(intRange) > 0 && len(strRange) == 0 || len(intRange) == 0 && len(strRange) > 0 {
-		return nil
+	if exclusive {
+		for k := 0; k < ncols; k++ {
+			include = append(include, k)
+		}
 	}
-	fmt.Println(intRange)
-	fmt.Println(strRange)
-	return nil
+	excluded := map[int]bool{}
+	for _, k := range exclude {
+		excluded[k] = true
+	}
+	var selector []int
+	for _, k := range include {
+		if !excluded[k] {
+			selector = append(selector, k)
+		}
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%w: no columns left", errInvalidFieldNames)
+	}
+	return selector, nil
 }
 
-// ColumnsByName selects columns by their name.
-// This we need to blend with Columns eventually.
-func (t *Table) ColumnsByName(s ...interface{}) {
-	if len(s) < 1 {
-		panic("Error you need to select at least 1 column")
+var (
+	indexRange  = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)$`)
+	letterRange = regexp.MustCompile(`^([A-Za-z]+)\s*:\s*([A-Za-z]+)$`)
+)
+
+// columnIndex checks an index against the number of columns.
+func columnIndex(k, ncols int) ([]int, error) {
+	if k < 0 || k >= ncols {
+		return nil, fmt.Errorf("%w: column %d, the table has %d columns", errInvalidRange, k, ncols)
 	}
+	return []int{k}, nil
+}
 
-	// We have input from the user save it n struct.
-	// We will validate later, when we start reading the csv
-	// file and we know the number of cells.
-	t.selectedColumns = append(t.selectedColumns, s...)
+// columnSpan returns the columns from start to end inclusive.
+func columnSpan(sel string, start, end, ncols int) ([]int, error) {
+	if start > end {
+		return nil, fmt.Errorf("%w: %q ends before it starts", errInvalidRange, sel)
+	}
+	if _, err := columnIndex(end, ncols); err != nil {
+		return nil, err
+	}
+	var cols []int
+	for k := start; k <= end; k++ {
+		cols = append(cols, k)
+	}
+	return cols, nil
+}
 
+// letterIndex returns the index of a spreadsheet column, A is 0.
+func letterIndex(s string) int {
+	k := 0
+	for _, r := range strings.ToUpper(s) {
+		k = k*26 + int(r-'A') + 1
+	}
+	return k - 1
 }
 
-// GetColumns gets the Columns selected by the user, validates the input
-// and returns a slice of column indices.
-// todo.
-func (t *Table) GetColumns() {
-	err := t.validateSelectedColumns(t.selectedColumns)
-	if err != nil {
-		fmt.Println(err)
-		fmt.Println("Ask Donald Knuth")
+// foldName folds a column name for a loose match.
+func foldName(s string) string {
+	s = strings.Replace(strings.ToLower(s), "_", " ", -1)
+	return strings.Join(strings.Fields(s), " ")
+}
 
+// matchNames returns the columns whose name satisfies match.
+func matchNames(names []string, match func(string) bool) []int {
+	var cols []int
+	for k, name := range names {
+		if match(strings.TrimSpace(name)) {
+			cols = append(cols, k)
+		}
 	}
+	return cols
 }
 
-// Vector maps the selected columns.
-func (t *Table) Vector(record []string) []string {
+// resolveColumn resolves a single selector, other than an exclusion.
+func resolveColumn(sel string, names []string, ncols int) ([]int, error) {
+	if len(sel) > 1 && strings.HasPrefix(sel, "/") && strings.HasSuffix(sel, "/") {
+		re, err := regexp.Compile(sel[1 : len(sel)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidFieldNames, err)
+		}
+		cols := matchNames(names, re.MatchString)
+		if len(cols) == 0 {
+			return nil, unknownColumn(sel, names)
+		}
+		return cols, nil
+	}
+
+	cols := matchNames(names, func(name string) bool { return name == sel })
+	if len(cols) > 1 {
+		return nil, fmt.Errorf("%w %q: it names columns %v", ErrAmbiguousColumn, sel, cols)
+	}
+	if len(cols) == 1 {
+		return cols, nil
+	}
+
+	if k, err := strconv.Atoi(sel); err == nil {
+		return columnIndex(k, ncols)
+	}
+	if m := indexRange.FindStringSubmatch(sel); m != nil {
+		start, _ := strconv.Atoi(m[1])
+		end, _ := strconv.Atoi(m[2])
+		return columnSpan(sel, start, end, ncols)
+	}
+	if m := letterRange.FindStringSubmatch(sel); m != nil {
+		return columnSpan(sel, letterIndex(m[1]), letterIndex(m[2]), ncols)
+	}
+
+	folded := foldName(sel)
+	cols = matchNames(names, func(name string) bool { return foldName(name) == folded })
+	switch {
+	case len(cols) > 1:
+		return nil, fmt.Errorf("%w %q: it names columns %v", ErrAmbiguousColumn, sel, cols)
+	case len(cols) == 0:
+		return nil, unknownColumn(sel, names)
+	}
+	return cols, nil
+}
+
+// unknownColumn reports a selector that names no column.
+func unknownColumn(sel string, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("%w %q: the table has no header to look it up", ErrUnknownColumn, sel)
+	}
+	quoted := make([]string, len(names))
+	for k, name := range names {
+		quoted[k] = strconv.Quote(strings.TrimSpace(name))
+	}
+	return fmt.Errorf("%w %q: the columns are %s", ErrUnknownColumn, sel, strings.Join(quoted, ", "))
+}
+
+// Vector maps the selected columns. If no columns have been
+// selected the record is returned as is. A record that is too short
+// returns a RecordError naming the missing column.
+func (t *Table) Vector(record []string) ([]string, error) {
 
-	// Check if we have selected user columns by name
 	if len(t.selector) == 0 {
-		t.GetColumns()
+		return record, nil
 	}
 
 	vector := make([]string, len(t.selector))
 
 	for k, v := range t.selector {
+		if v >= len(record) {
+			return nil, &RecordError{File: t.inpath, Column: v, Err: ErrShortRecord}
+		}
 		vector[k] = record[v]
 	}
-	return vector
+	return vector, nil
 }
 
 // SkipFirstN skips the first n lines from the table.
@@ -304,6 +563,10 @@ func (t *Table) SkipFirstN(n int) {
 
 // skip lines
 func (t *Table) skiplines() {
+	if s, ok := t.rd.(skipper); ok {
+		s.Skip(t.SkipN)
+		return
+	}
 	if t.SkipN > 0 {
 		for i := 0; i < t.SkipN; i++ {
 			t.rd.Read()
@@ -369,9 +632,10 @@ func RowColor(colorname string) string {
 // End function handles the closing of the table
 // and any landscape or float wrapper.
 // end{tabular}
-//      endgroup
-//       end{landscape}
-//          end{table}
+//
+//	endgroup
+//	 end{landscape}
+//	    end{table}
 func (t *Table) End(w io.Writer) {
 	var buf bytes.Buffer
 	out := buf.WriteString
@@ -450,7 +714,7 @@ func (t *Table) Begin(w io.Writer, prop map[string]string) string {
 	t.property = propstr
 
 	// Write the banner on top of the table
-	out(Banner())
+	out(t.banner())
 	if t.Landscape {
 		landscape = "\\begin{landscape}"
 	}
@@ -460,7 +724,7 @@ func (t *Table) Begin(w io.Writer, prop map[string]string) string {
 	out(`\cxset{palette ` + prop["palette"] + `}%` + "\n")
 	out(columnType)
 	out(t.property)
-	out(`\begin{` + t.Type + `}` + tableAlign(prop) + prop["specifier"] + "\n")
+	out(`\begin{` + t.Type + `}` + tableAlign(prop) + t.Specifier(prop) + "\n")
 	if floatStart == "" {
 		out(t.CaptionStyle.String() + " ")
 		out(t.RefLabelCmd())
@@ -522,9 +786,15 @@ func (t *Table) GetEveryNRow() string {
 // If any updates are required to dataframes or database they are done here.
 // Any need for multicolumns, should be carried out here.
 func (t *Table) ProcessRow(w io.Writer, record []string) {
+	t.line = 0
+	t.processRow(w, NewFields(record))
+}
+
+// processRow is ProcessRow for a row of typed cells.
+func (t *Table) processRow(w io.Writer, fields []Field) {
 	s := t.ColorAllRows() // move to table bg
 	// Process Records
-	s += t.ProcessRecord(w, record)
+	s += t.processRecord(fields)
 	// every nth row
 	s += t.GetEveryNRow()
 	if t.currentline == 6 {
@@ -539,27 +809,143 @@ func (t *Table) ProcessRow(w io.Writer, record []string) {
 // any sorting of records. It writes its contents to
 // an io.Writer.
 func (t *Table) ProcessRecord(w io.Writer, record []string) string {
-	v := ""
+	t.line = 0
+	return t.processRecord(NewFields(record))
+}
+
+// maxDiagnostics is the number of problems kept
+// if t.MaxDiagnostics is zero.
+const maxDiagnostics = 1000
+
+// warn records a problem that does not stop the rendering.
+func (t *Table) warn(err error) {
+	max := t.MaxDiagnostics
+	if max <= 0 {
+		max = maxDiagnostics
+	}
+	if len(t.Diagnostics) >= max {
+		t.DroppedDiagnostics++
+		return
+	}
+	t.Diagnostics = append(t.Diagnostics, err)
+}
+
+// fail records the error that stopped the rendering and returns it.
+func (t *Table) fail(err error) error {
+	t.Err = err
+	return err
+}
+
+// writeFile renders a table to a file, replaced
+// atomically by replaceFile.
+func (t *Table) writeFile(fname string, render func(w io.Writer, r io.Reader) error) error {
+	if t.Raw == nil {
+		return t.fail(errNoInput)
+	}
+	return t.fail(replaceFile(fname, func(w io.Writer) error {
+		return render(w, bytes.NewReader(t.Raw))
+	}))
+}
+
+// replaceFile writes the file fname through a temporary file in the
+// same directory, renamed over fname once complete. A LaTeX run
+// reading fname meanwhile sees the old file or the new one, never
+// a part of it, and a failure leaves the old file untouched. When
+// the new bytes are those of the old file, fname is not rewritten.
+func replaceFile(fname string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), "."+filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && sameFile(tmp.Name(), fname) {
+		// leave the old file and its time alone, or
+		// make and latexmk would think it changed
+		return os.Remove(tmp.Name())
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// sameFile reports whether the files a and b have the same bytes.
+func sameFile(a, b string) bool {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+	if sa, sb := statSize(fa), statSize(fb); sa < 0 || sa != sb {
+		return false
+	}
+	ra, rb := bufio.NewReader(fa), bufio.NewReader(fb)
+	for {
+		ca, erra := ra.ReadByte()
+		cb, errb := rb.ReadByte()
+		if erra != nil || errb != nil {
+			return erra == io.EOF && errb == io.EOF
+		}
+		if ca != cb {
+			return false
+		}
+	}
+}
+
+func statSize(f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return -1
+	}
+	return fi.Size()
+}
+
+// processRecord is ProcessRecord for a row of typed cells. The
+// type of the cell rather than its text decides how it is typeset.
+func (t *Table) processRecord(record []Field) string {
+	if len(record) == 0 {
+		return ""
+	}
 	t.EveryCell("", "") // only as example
 	sb := t.everyCellBefore.String()
 	sa := t.everyCellAfter.String()
+	values := t.texValues(record)
 
 	// prepend and append everycell tokens
-	s := sb + record[0] + sa
+	s := sb + values[0] + sa
 
-	for _, v = range record[1:] {
+	for k, f := range record[1:] {
 		// handle cell first
-		v = strings.TrimSpace(v)
+		v := strings.TrimSpace(values[k+1])
+		numeric := f.t == IntegerCell || f.t == DecimalCell
 
-		// format negative numbers
-		if is.Numeric(v) {
+		// S columns take care of the number themselves
+		// and want anything else, percentages too, in braces
+		if t.sColumn(k+1) && numeric && !strings.HasSuffix(v, `\%`) {
 			v = strings.Replace(v, ",", "", -1)
-			if strings.HasPrefix(v, "-") {
-				v = "\\textcolor{red}{" + `\num{` + v + `}` + "}"
-			} else {
-				v = `\num{` + v + `}`
-				// process non-numeric cell contents
-			}
+		} else if t.sColumn(k+1) && v != "" {
+			v = "{" + v + "}"
+		} else if numeric {
+			// format negative numbers
+			v = formatNumber(v)
 		}
 		v = sb + v + sa
 
@@ -573,70 +959,63 @@ func (t *Table) ProcessRecord(w io.Writer, record []string) string {
 // ReadCSV converts a csv file into a .tex file
 // containing filtered fields of a t.
 // fields []int,
-func (t *Table) ReadCSV(fname string, summation bool, prop map[string]string) {
-	var vector []string
-	//err :=nil
-	fields := t.selector
-	f1, _ := os.Create(fname)
-	t.w = bufio.NewWriter(f1)
-	w := t.w
+// The csv is the one read by Clean. The first error
+// met is returned and also kept in t.Err.
+func (t *Table) ReadCSV(fname string, summation bool, prop map[string]string) error {
+	t.summation = summation
+	defer func() { t.summation = false }()
+	return t.writeFile(fname, func(w io.Writer, r io.Reader) error {
+		return t.Render(w, r, prop)
+	})
+}
+
+// Render reads a csv from r and writes the table to w. The input
+// is taken as is, use CleanReader first if it needs cleaning.
+func (t *Table) Render(out io.Writer, r io.Reader, prop map[string]string) error {
 	t.prop = prop
 	t.Type = prop["type"]
 
-	fmt.Fprintln(w, t.Begin(w, prop))
-
-	count := 0
-	f, _ := os.Open(t.outpath)
-
-	defer f.Close()
-	t.rd = csv.NewReader(f)
-
-	//rd := t.rd
-	t.csvDefaultSettings()
-
-	t.skiplines()
-	t.renderHead()
+	// load the table first, the specifier is
+	// optional and if missing we guess it from the data
+	if err := t.Load(r); err != nil {
+		return t.fail(err)
+	}
+	return t.fail(t.renderRows(out, t.loaded()))
+}
 
-	for {
-		record, err := t.Read()
+// renderRows renders the rows one at a time, as they come.
+func (t *Table) renderRows(out io.Writer, next rowIterator) error {
+	rd := t.renderer()
+	if err := rd.Begin(t, out); err != nil {
+		return err
+	}
 
+	sums := t.totals()
+	for t.currentline = 1; ; t.currentline++ {
+		row, line, err := next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			fmt.Println("Error:", err)
+			return err
 		}
-
-		vector = nil
-		for _, v := range fields {
-			log.Println(v, record[v])
-			vector = append(vector, record[v])
-		}
-
-		//if record[8] != "" && record[0] != "" {
-		count++
-
-		t.ProcessRow(w, vector)
-		if prop["rowlines"] == "true" {
-			fmt.Fprintln(w, "\\hline")
+		vector, err := t.lineVector(row, line)
+		if err != nil {
+			return err
 		}
+		rd.Row(sums.add(vector))
 	}
+	sums.grandTotal(rd, len(t.pickColumns()))
 
-	t.closeTabular(w)
+	return rd.End()
 }
 
-// Read reads the next line.
+// Read reads the next line from the source.
 func (t *Table) Read() ([]string, error) {
 	return t.rd.Read()
 }
 
-func (t *Table) csvDefaultSettings() {
-	t.rd.Comma = ','
-	t.rd.LazyQuotes = true
-	//t.rd.FieldsPerRecord = -1 //allows missing
-}
-
 // renderHead renders the heading of a table.
-func (t *Table) renderHead() {
+func (t *Table) renderHead() error {
 	var buf bytes.Buffer
 	w := t.w
 
@@ -670,7 +1049,7 @@ func (t *Table) renderHead() {
 			mc := "\\multicolumn{1}{|>{\\color{" + "thetableheadcolor" + "}\\bfseries}c|}"
 			str := ""
 			for j := 0; j < len(t.Header.M[i]); j++ {
-				str += mc + "{" + t.Header.M[i][j] + "} "
+				str += mc + "{" + EscapeLaTeX(t.Header.M[i][j]) + "} "
 				if j < len(t.Header.M[i])-1 {
 					str += " &"
 				}
@@ -695,24 +1074,20 @@ func (t *Table) renderHead() {
 		// render to io.Writer
 		fmt.Fprint(w, buf.String())
 
-	case t.HasHeader:
-		record, err := t.Read()
-		if err != nil {
-			fmt.Println("Error: ", err)
-		}
-
-		for i := 0; i < len(t.Header.M); i++ {
-			record, err = t.Read()
-
-			// need to filter here
-			lbl := strings.Join(record, " &") + "\\\\ \n"
-
+	// The header rows were kept aside by Load.
+	case t.header:
+		for n, record := range t.headRows {
+			vector, err := t.headVector(record, n)
+			if err != nil {
+				return err
+			}
+			lbl := strings.Join(escapeAll(vector), " &") + "\\\\ \n"
 			hlines = append(hlines, lbl)
-			fmt.Fprint(w, t.TableHeader(hlines))
-			log.Println(record)
 		}
+		fmt.Fprint(w, t.TableHeader(hlines))
 
 	}
+	return nil
 }
 
 // renders a TeX comment line
@@ -738,163 +1113,200 @@ func (t *Table) longTableContinuation(hlines []string) string {
 
 // SectionCSV converts a csv file into a tex file
 // It handles longtbales with sections (they look more like documents).
-func (t *Table) SectionCSV(fname string, summation bool, prop map[string]string) {
+// The csv is the one read by Clean. The first error
+// met is returned and also kept in t.Err.
+func (t *Table) SectionCSV(fname string, summation bool, prop map[string]string) error {
+	t.summation = summation
+	defer func() { t.summation = false }()
+	return t.writeFile(fname, func(w io.Writer, r io.Reader) error {
+		return t.RenderSections(w, r, prop)
+	})
+}
 
-	//fields := t.selector
-	f1, _ := os.Create(fname)
-	t.w = bufio.NewWriter(f1)
-	w := t.w
+// RenderSections is the io.Reader and io.Writer version
+// of SectionCSV.
+func (t *Table) RenderSections(out io.Writer, r io.Reader, prop map[string]string) error {
 	t.prop = prop
 	t.Type = prop["type"]
 
-	fmt.Fprintln(w, t.Begin(w, prop))
-	f, _ := os.Open(t.outpath)
-	defer f.Close()
-
-	// csv settings
-	t.rd = csv.NewReader(f)
-	t.csvDefaultSettings()
-	t.skiplines()
-	t.renderHead()
-
-	t.currentline = 0
-	var inHead = false
+	// load the table first, the specifier is
+	// optional and if missing we guess it from the data
+	if err := t.Load(r); err != nil {
+		return t.fail(err)
+	}
+	return t.fail(t.renderSections(out, t.loaded()))
+}
 
-	for {
+// renderSections renders the rows one at a time, as they come,
+// acting on the triggers. Only the running sums are kept.
+func (t *Table) renderSections(out io.Writer, next rowIterator) error {
+	triggers, err := t.Trigger.rules()
+	if err != nil {
+		return err
+	}
+	if t.SectionTitles != nil {
+		t.SectionTitles.unmapped = nil
+	}
+	t.Mismatches = nil
 
-		t.currentline++
-		record, err := t.Read()
+	rd := t.renderer()
+	if err := rd.Begin(t, out); err != nil {
+		return err
+	}
 
-		// save the number of cells we will need it later
-		t.ncols = len(record)
+	var inHead = false
+	// sums of the detail rows, a section ends with a subtotal
+	// or a section heading
+	sums := t.totals()
+	ncols := len(t.pickColumns())
+	sectioned := false
+
+	for t.currentline = 1; ; t.currentline++ {
+		row, line, err := next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		record := Values(row)
 
 		// skip empty lines
 		if len(strings.Join(record, "")) == 0 {
 			log.Println("EMPTY RECORD DETECTION")
 			if t.EmptyToLine {
-				fmt.Fprintln(w, "\\hline")
+				rd.Blank()
 			}
-			record, err = t.Read()
+			continue
 		}
 
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			fmt.Println("Error:", err)
+		// If we have a trigger word we need to take action. The rules
+		// are matched first so that the error values of a row they
+		// skip are not handled, nor fail the table.
+		rule := match(triggers, record, row)
+		if rule != nil && rule.Action == SkipRow {
+			continue
 		}
 
-		vector := t.Vector(record)
+		fields, err := t.lineVector(row, line)
+		if err != nil {
+			return err
+		}
 		// needs fixing
-		vector[3] = PrintTitleCase(vector[3])
-
-		// detects empty lines find a better method
-		condition := false
-		if len(record) > 8 {
-			if record[8] != "" && record[0] != "" {
-				condition = true
-			}
-		} else {
-			condition = true
+		if len(fields) > 3 {
+			fields[3].Value = PrintTitleCase(fields[3].Value)
 		}
 
-		if condition {
-
-			// If we have a trigger word we need to take action
-			if strings.HasPrefix(strings.TrimSpace(record[1]), "SUBTOTAL") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "SUBCONTRACTS") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "MATERIALS") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "TEC-VAR") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "CONTRACTS") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "CINEMA") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "GRAND") ||
-				strings.HasPrefix(strings.TrimSpace(record[1]), "TOTAL") {
-
-				//continue
-				// check if we need midrule
-				//t.PrintMidrule(w, "1.5pt")
-				fmt.Fprintln(w, rules.MidRule("1.5pt"))
-				mult := "&\\multicolumn{3}{|p{3.5cm}|}{\\textbf{%s}}"
-
-				tmp := fmt.Sprintf("%s", vector[0]) //ok
-
-				tmp += fmt.Sprintf(mult, vector[1]) //ok
-
-				for i := 4; i < len(vector); i++ {
-					tmp += fmt.Sprintf(" &%s", vector[i])
-				}
-				tmp += " \\\\\n"
-				fmt.Fprintln(w, tmp)
-				//log.Println(tmp)
-
-				fmt.Fprintln(w, rules.MidRule("1.5pt"))
-				t.AddVertSpace(w, len(vector))
-				inHead = true
-
-				//fmt.Fprintln(w, "\\bottomrule")
-
-			} else {
-
-				if inHead == true {
-
-					if t.HasSections == true {
-						//t.AddVertSpace(w, len(vector))
-
-						sect := GetSectionTitle(record[1])
-						fmt.Fprintf(w, "%s\n", AddSection(sect, len(vector)))
-						fmt.Fprintln(w, rules.MidRule("1.5pt"))
-						//t.TableHeader(w, labels)
-						t.ProcessRow(w, vector)
-						inHead = false
+		if rule != nil {
+			switch rule.Action {
+			case SubtotalRow:
+				// the sheet carries its own subtotal
+				if t.Audit.Enabled {
+					if err := t.audit(sums, line, fields, record[rule.Column]); err != nil {
+						return err
 					}
 				}
-
-				// Print non-header, non-summation lines
-				// PROCESS ROW FIRST
-				t.ProcessRow(w, vector)
-				if prop["rowlines"] == "true" {
-					fmt.Fprintln(w, "\\hline")
-				}
+				sums.section.reset()
+				sectioned = true
+				rd.Span(rule, sums.pad(fields))
+				inHead = true
+				continue
+			case MulticolumnRow:
+				rd.Span(rule, sums.pad(fields))
+				continue
+			case SectionRow:
+				sums.subtotal(rd, ncols)
+				sectioned = true
+				rd.Section(strings.TrimSpace(record[rule.Column]), rule.Width)
 				inHead = false
-
+				continue
+			case MidruleRow:
+				rd.Rule(rule.Width)
+			case PageBreakRow:
+				rd.PageBreak()
 			}
 		}
 
+		// the first row after a subtotal opens a new section
+		if inHead && t.HasSections {
+			rd.Section(t.sectionTitle(record), "1.5pt")
+		}
+
+		// Print non-header, non-summation lines
+		rd.Row(sums.add(fields))
+		inHead = false
 	}
-	// Finally we close the tabular
-	t.closeTabular(w)
+	if sectioned {
+		sums.subtotal(rd, ncols)
+	}
+	sums.grandTotal(rd, ncols)
+	t.warnUnmapped()
+
+	// Finally we close the table
+	return rd.End()
 }
 
 // closes the table environment
-func (t *Table) closeTabular(w *bufio.Writer) {
+func (t *Table) closeTabular(w *bufio.Writer) error {
 	fmt.Fprintln(w, rules.AddLineSpace("0pt"))
 	fmt.Fprintln(w, rules.BottomRule())
 	t.End(w)
-	w.Flush() // do not forget to flush the buffer
+	return w.Flush() // do not forget to flush the buffer
 }
 
 // Clean satisfies the Cleaner interface
 // It takes a filename or path and performs
 // a number of replacements and transformations
-// to clean the raw text from common errors.
-func (t *Table) Clean(fname string) []byte {
+// to clean the raw text from common errors. The
+// text is not escaped, see EscapeLaTeX.
+// The cleaned bytes are kept in t.Raw, ready for ReadCSV
+// or SectionCSV. Nothing is written back to disk.
+func (t *Table) Clean(fname string) ([]byte, error) {
 	t.inpath = fname
-	outfile := ""
-	s, _ := ioutil.ReadFile(fname)
-	s1 := strings.Replace(string(s), "\r\n", "\n", -1)
-	s1 = strings.Replace(string(s1), "&", "\\&", -1)
-	s1 = strings.Replace(string(s1), "%", "\\%", -1)
-	s1 = strings.Replace(string(s1), "#DIV/0!", "0.0", -1)
-	s1 = strings.Replace(string(s1), "#", "\\#", -1)
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, t.fail(err)
+	}
+	defer f.Close()
+	return t.CleanReader(f)
+}
 
-	if strings.HasSuffix(fname, ".csv") {
-		outfile = strings.TrimSuffix(fname, ".csv") + "a" + ".csv"
+// CleanReader converts everything read from r to UTF-8,
+// cleans it and keeps the result in t.Raw. The workbooks
+// are kept as they are.
+func (t *Table) CleanReader(r io.Reader) ([]byte, error) {
+	if t.isBinary() {
+		// a workbook is read as it is
+		s, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, t.fail(err)
+		}
+		t.inhash = hashBytes(s)
+		t.Raw = s
+		return t.Raw, nil
+	}
+	// the hash is of the source as it is on disk
+	h := sha256.New()
+	dec, err := t.decode(io.TeeReader(r, h))
+	if err != nil {
+		return nil, t.fail(err)
 	}
-	err := ioutil.WriteFile(outfile, []byte(s1), 0666)
-	t.outpath = outfile
+	s, err := ioutil.ReadAll(dec)
 	if err != nil {
-		fmt.Println(err)
+		return nil, t.fail(err)
 	}
-	return t.Raw
+	t.inhash = hex.EncodeToString(h.Sum(nil))
+	t.Raw = CleanBytes(s)
+	return t.Raw, nil
+}
+
+// CleanBytes performs the replacements of Clean in memory. The
+// text is not escaped for LaTeX here: the LaTeX renderer escapes
+// every cell, see EscapeLaTeX, and the other formats need the
+// text as it is. Nor are the spreadsheet error values replaced,
+// each cell is handled as t.ErrorValues says.
+func CleanBytes(s []byte) []byte {
+	s1 := strings.Replace(string(s), "\r\n", "\n", -1)
+	return []byte(s1)
 }
 
 // AddSection adds a section as a Table row in a long
@@ -903,40 +1315,6 @@ func AddSection(s string, ncells int) string {
 	return `\multicolumn{` + strconv.Itoa(ncells) + `}{l}{\textbf{` + s + `}}\\`
 }
 
-// GetSectionTitle is a weird feature but necessary of we are exporting from
-// excel for enterprise style spreadsheets. These in many instances
-// have numerous rows with subtotals, notes and the like.
-// Section titles are input as map[string]string and processed here.
-// They are simple replacement routines, but they are also triggers
-// that can typeset the row contents differently using multicolumn.
-// This is an example, will be replaced by a settings function in the
-// next revision.
-func GetSectionTitle(s string) string {
-	switch {
-	case strings.HasPrefix(s, "TEC"):
-		return "SECTION THEME EXPERIENCE CENTER"
-	case strings.HasPrefix(s, "SUB-SMR"):
-		return "SECTION SMART SYSTEMS"
-	case strings.HasPrefix(s, "SUB-E"):
-		return "SECTION SUBCONTRACTS IN CORE CONTRACT"
-	case strings.HasPrefix(s, "SUB-M"):
-		return "SECTION SUBCONTRACT PS"
-	case strings.HasPrefix(s, "GEN"):
-		return "SECTION INDIRECT SITE COSTS"
-	case strings.HasPrefix(s, "PC-"):
-		return "SECTION PC SUMS (All)"
-	case strings.HasPrefix(s, "HVAC"):
-		return "SECTION HVAC"
-	case strings.HasPrefix(s, "EL-EQ"):
-		return "SECTION ELECTRICAL"
-	case strings.HasPrefix(s, "SUBCONTRACTS"):
-		return "SECTION SUBCONTRACTS"
-	default:
-		return "SECTION UNKNOWN"
-	}
-
-}
-
 // PrintTitleCase prints a string as Title Cased. If the word
 // is fully capitalized it will change it to a lower case and
 // then if it is not in a lisyt of abbreviations that are normally
@@ -971,7 +1349,22 @@ func PrintTitleCase(s string) string {
 // generated automatically.
 func Banner() string {
 	s := fmt.Sprintf("%%%% This file has been generated from a csv file.\n")
-	s += fmt.Sprintf("%%%% automatically by the phd-cli = %s\n", "version 0.20")
+	s += fmt.Sprintf("%%%% automatically by the phd-cli = version %s\n", Version)
 	s += fmt.Sprintf("%%%% to get help to regenerate type phd-cli help\n")
 	return s
 }
+
+// banner is Banner followed by the input and its hash, so that
+// a table older than its csv can be spotted with sha256sum.
+func (t *Table) banner() string {
+	if t.inhash == "" {
+		return Banner()
+	}
+	return Banner() + fmt.Sprintf("%%%% source %s sha256 %s\n", filepath.ToSlash(t.inpath), t.inhash)
+}
+
+// InputHash returns the sha256, in hex, of the
+// last input cleaned or streamed from a file.
+func (t *Table) InputHash() string {
+	return t.inhash
+}
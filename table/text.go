@@ -0,0 +1,424 @@
+package table
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// textCell is a cell of a table laid out as text.
+type textCell struct {
+	text  string
+	span  int
+	align byte
+	bold  bool
+}
+
+// textRow is a row of a table laid out as text.
+type textRow struct {
+	cells []textCell
+	// above draws a rule above the row
+	above bool
+}
+
+// layout collects the rows of a table for the renderers that
+// must see the whole table before they write it, such as the
+// markdown and the plain text ones. It implements every method
+// of Renderer except End.
+type layout struct {
+	t    *Table
+	out  io.Writer
+	cols []Column
+	head [][]string
+	rows []textRow
+	// rule draws a rule above the next row
+	rule bool
+}
+
+func (l *layout) Begin(t *Table, w io.Writer) error {
+	l.t = t
+	l.out = w
+	l.cols = t.pickColumns()
+	l.head = t.Header.M
+	l.rows = nil
+	l.rule = false
+	if len(l.head) == 0 && t.header {
+		for n, record := range t.headRows {
+			vector, err := t.headVector(record, n)
+			if err != nil {
+				return err
+			}
+			l.head = append(l.head, vector)
+		}
+	}
+	return nil
+}
+
+// align returns the alignment of the k-th column.
+func (l *layout) align(k int) byte {
+	if k < len(l.cols) {
+		return l.cols[k].Align()
+	}
+	return 'l'
+}
+
+// cell lays out a field of the k-th column.
+func (l *layout) cell(k int, f Field) textCell {
+	return textCell{text: plainValue(f), span: 1, align: l.align(k)}
+}
+
+// add appends a row, padded to the number of columns.
+func (l *layout) add(row textRow) {
+	n := 0
+	for _, c := range row.cells {
+		n += c.span
+	}
+	for k := n; k < len(l.cols); k++ {
+		row.cells = append(row.cells, textCell{span: 1, align: l.align(k)})
+	}
+	row.above = row.above || l.rule
+	l.rule = false
+	l.rows = append(l.rows, row)
+}
+
+func (l *layout) Row(fields []Field) {
+	var row textRow
+	for k, f := range fields {
+		row.cells = append(row.cells, l.cell(k, f))
+	}
+	l.add(row)
+}
+
+func (l *layout) Span(rule *Rule, fields []Field) {
+	if len(fields) == 0 {
+		return
+	}
+	start := rule.Start
+	if start >= len(fields) {
+		start = len(fields) - 1
+	}
+	span := rule.Span
+	if span < 1 {
+		span = 1
+	}
+	if start+span > len(fields) {
+		span = len(fields) - start
+	}
+
+	subtotal := rule.Action == SubtotalRow
+	row := textRow{above: subtotal}
+	for k, f := range fields[:start] {
+		row.cells = append(row.cells, l.cell(k, f))
+	}
+	label := textCell{text: plainValue(fields[start]), span: span, align: 'l', bold: true}
+	row.cells = append(row.cells, label)
+	for k, f := range fields[start+span:] {
+		row.cells = append(row.cells, l.cell(start+span+k, f))
+	}
+	l.add(row)
+	l.rule = subtotal
+}
+
+func (l *layout) Section(title, width string) {
+	l.add(textRow{
+		cells: []textCell{{text: plainValue(Field{Value: title}), span: len(l.cols), align: 'l', bold: true}},
+		above: true,
+	})
+	l.rule = true
+}
+
+func (l *layout) Rule(width string) {
+	l.rule = true
+}
+
+// PageBreak draws a rule, text has no pages.
+func (l *layout) PageBreak() {
+	l.rule = true
+}
+
+func (l *layout) Blank() {
+	l.add(textRow{})
+}
+
+func (l *layout) Total(label string, at, span int, fields []Field) {
+	row := textRow{above: true}
+	for k := 0; k < len(fields); k++ {
+		if k == at && span > 0 {
+			row.cells = append(row.cells, textCell{text: label, span: span, align: 'l', bold: true})
+			k += span - 1
+			continue
+		}
+		row.cells = append(row.cells, l.cell(k, fields[k]))
+	}
+	l.add(row)
+	l.rule = true
+}
+
+// plainValue returns the text of a cell for the text formats.
+// Numbers are formatted as ProcessRecord formats them for LaTeX,
+// here with grouping commas instead of siunitx.
+func plainValue(f Field) string {
+	v := strings.TrimSpace(f.Value)
+	if f.t == IntegerCell || f.t == DecimalCell {
+		return groupDigits(strings.Replace(v, ",", "", -1))
+	}
+	return v
+}
+
+// groupDigits puts commas between the thousands of a number.
+func groupDigits(v string) string {
+	sign := ""
+	if strings.HasPrefix(v, "-") || strings.HasPrefix(v, "+") {
+		sign, v = v[:1], v[1:]
+	}
+	frac := ""
+	if i := strings.Index(v, "."); i >= 0 {
+		v, frac = v[:i], v[i:]
+	}
+	var b strings.Builder
+	for k, r := range v {
+		if k > 0 && (len(v)-k)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + frac
+}
+
+// TextRenderer renders a table as plain text framed with box
+// drawing characters, for terminals and plain text mail.
+//
+//	┌────┬───────┬──────────┐
+//	│ SR │ CAT   │     COST │
+//	╞════╪═══════╪══════════╡
+//	│  1 │ TEC-A │ 1,100.00 │
+//	└────┴───────┴──────────┘
+type TextRenderer struct {
+	// Wrap is the width at which long text cells are wrapped.
+	// If zero they are never wrapped.
+	Wrap int
+	layout
+}
+
+// NewTextRenderer creates a renderer that wraps text at 40 characters.
+func NewTextRenderer() *TextRenderer {
+	return &TextRenderer{Wrap: 40}
+}
+
+// box drawing characters of a rule: the left and right ends, the
+// line and the junctions with a column border above, below or both.
+type boxRule struct {
+	left, right, line, up, down, cross string
+}
+
+var (
+	topRule    = boxRule{"┌", "┐", "─", "─", "┬", "┬"}
+	midRule    = boxRule{"├", "┤", "─", "┴", "┬", "┼"}
+	headRule   = boxRule{"╞", "╡", "═", "╧", "╤", "╪"}
+	bottomRule = boxRule{"└", "┘", "─", "┴", "─", "┴"}
+)
+
+// runeWidth returns the number of characters of s.
+func runeWidth(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// wrap breaks s into lines of at most n characters, at spaces
+// where it can.
+func wrap(s string, n int) []string {
+	if n < 1 || runeWidth(s) <= n {
+		return []string{s}
+	}
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for runeWidth(word) > n {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			r := []rune(word)
+			lines = append(lines, string(r[:n]))
+			word = string(r[n:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case runeWidth(line)+1+runeWidth(word) <= n:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	return append(lines, line)
+}
+
+// pad aligns s in a field of n characters.
+func pad(s string, n int, align byte) string {
+	gap := n - runeWidth(s)
+	if gap <= 0 {
+		return s
+	}
+	switch align {
+	case 'r':
+		return strings.Repeat(" ", gap) + s
+	case 'c':
+		return strings.Repeat(" ", gap/2) + s + strings.Repeat(" ", gap-gap/2)
+	}
+	return s + strings.Repeat(" ", gap)
+}
+
+// headRows returns the head as rows of cells.
+func (r *TextRenderer) headRows() []textRow {
+	var rows []textRow
+	for _, record := range r.head {
+		var row textRow
+		for k, v := range record {
+			row.cells = append(row.cells, textCell{text: plainValue(Field{Value: v}), span: 1, align: r.align(k)})
+		}
+		for k := len(record); k < len(r.cols); k++ {
+			row.cells = append(row.cells, textCell{span: 1})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// widths returns the width of every column. Long text
+// columns are narrowed to Wrap.
+func (r *TextRenderer) widths(rows []textRow) []int {
+	widths := make([]int, len(r.cols))
+	for _, row := range rows {
+		k := 0
+		for _, c := range row.cells {
+			if c.span == 1 && k < len(widths) && runeWidth(c.text) > widths[k] {
+				widths[k] = runeWidth(c.text)
+			}
+			k += c.span
+		}
+	}
+	for k := range widths {
+		if r.Wrap > 0 && widths[k] > r.Wrap && r.cols[k].Type == TextCell {
+			widths[k] = r.Wrap
+		}
+		if widths[k] == 0 {
+			widths[k] = 1
+		}
+	}
+	return widths
+}
+
+// borders returns the columns followed by a border inside a row.
+func borders(row textRow, ncols int) map[int]bool {
+	b := map[int]bool{}
+	k := 0
+	for _, c := range row.cells {
+		k += c.span
+		if k < ncols {
+			b[k-1] = true
+		}
+	}
+	return b
+}
+
+// rule writes a horizontal rule between two rows, either may be nil.
+func (r *TextRenderer) rule(w *bufio.Writer, box boxRule, widths []int, above, below *textRow) {
+	var up, down map[int]bool
+	if above != nil {
+		up = borders(*above, len(widths))
+	}
+	if below != nil {
+		down = borders(*below, len(widths))
+	}
+	w.WriteString(box.left)
+	for k, n := range widths {
+		w.WriteString(strings.Repeat(box.line, n+2))
+		if k == len(widths)-1 {
+			break
+		}
+		switch {
+		case up[k] && down[k]:
+			w.WriteString(box.cross)
+		case up[k]:
+			w.WriteString(box.up)
+		case down[k]:
+			w.WriteString(box.down)
+		default:
+			w.WriteString(box.line)
+		}
+	}
+	w.WriteString(box.right + "\n")
+}
+
+// row writes a row, its cells wrapped to their widths.
+func (r *TextRenderer) row(w *bufio.Writer, row textRow, widths []int) {
+	var lines [][]string
+	var spans []int
+	height := 1
+	k := 0
+	for _, c := range row.cells {
+		n := -3
+		for j := k; j < k+c.span && j < len(widths); j++ {
+			n += widths[j] + 3
+		}
+		k += c.span
+		cl := wrap(c.text, n)
+		if len(cl) > height {
+			height = len(cl)
+		}
+		lines = append(lines, cl)
+		spans = append(spans, n)
+	}
+	for i := 0; i < height; i++ {
+		w.WriteString("│")
+		for j, c := range row.cells {
+			s := ""
+			if i < len(lines[j]) {
+				s = lines[j][i]
+			}
+			w.WriteString(" " + pad(s, spans[j], c.align) + " │")
+		}
+		w.WriteString("\n")
+	}
+}
+
+// End writes the caption, if any, and the table.
+func (r *TextRenderer) End() error {
+	w := bufio.NewWriter(r.out)
+	if len(r.cols) == 0 {
+		return w.Flush()
+	}
+	if c := r.t.CaptionStyle.Heading(); c != "" {
+		w.WriteString(c + "\n")
+	}
+
+	head := r.headRows()
+	widths := r.widths(append(head, r.rows...))
+	var prev *textRow
+	for k := range head {
+		if prev == nil {
+			r.rule(w, topRule, widths, nil, &head[k])
+		}
+		r.row(w, head[k], widths)
+		prev = &head[k]
+	}
+	for k := range r.rows {
+		row := &r.rows[k]
+		switch {
+		case prev == nil:
+			r.rule(w, topRule, widths, nil, row)
+		case k == 0 && len(head) > 0:
+			r.rule(w, headRule, widths, prev, row)
+		case row.above:
+			r.rule(w, midRule, widths, prev, row)
+		}
+		r.row(w, *row, widths)
+		prev = row
+	}
+	if prev != nil {
+		r.rule(w, bottomRule, widths, prev, nil)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,192 @@
+package table
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Totals configures the sums the package computes itself. All
+// positions refer to the selected columns. The arithmetic uses
+// exact decimals, so amounts do not pick up any float rounding.
+type Totals struct {
+	// Columns are the columns to sum. If empty every
+	// numeric column except the first one is summed.
+	Columns []int
+	// Sections adds a subtotal at the end of every section.
+	Sections bool
+	// Grand adds a grand total at the end of the table.
+	Grand bool
+	// Running appends a column with the running total
+	// of each of these columns.
+	Running []int
+
+	SubtotalLabel string
+	GrandLabel    string
+	// Width is the width of the midrules around a total.
+	Width string
+}
+
+// accumulator sums the detail rows of a table or a section.
+type accumulator struct {
+	columns []int
+	sums    []*big.Rat
+	rows    int
+}
+
+func newAccumulator(columns []int) *accumulator {
+	a := &accumulator{columns: columns}
+	a.reset()
+	return a
+}
+
+func (a *accumulator) reset() {
+	a.sums = make([]*big.Rat, len(a.columns))
+	for k := range a.sums {
+		a.sums[k] = new(big.Rat)
+	}
+	a.rows = 0
+}
+
+// add adds the numeric cells of a row.
+func (a *accumulator) add(vector []Field) {
+	for k, c := range a.columns {
+		if c < len(vector) && vector[c].num != nil {
+			a.sums[k].Add(a.sums[k], vector[c].num)
+		}
+	}
+	a.rows++
+}
+
+// summing holds the state of the totals while a table is rendered.
+type summing struct {
+	Totals
+	columns []Column
+	section *accumulator
+	grand   *accumulator
+	running []*big.Rat
+}
+
+// totals prepares the sums for a rendering. The summation argument
+// of ReadCSV and SectionCSV switches on the section and grand totals.
+func (t *Table) totals() *summing {
+	s := &summing{Totals: t.Totals, columns: t.pickColumns()}
+	if t.summation {
+		s.Sections = true
+		s.Grand = true
+	}
+	if s.SubtotalLabel == "" {
+		s.SubtotalLabel = "Subtotal"
+	}
+	if s.GrandLabel == "" {
+		s.GrandLabel = "Grand Total"
+	}
+	columns := s.Columns
+	if len(columns) == 0 {
+		for k, c := range s.columns {
+			// running totals have no source column
+			if k > 0 && c.Index >= 0 && c.Type.Numeric() {
+				columns = append(columns, k)
+			}
+		}
+	}
+	s.section = newAccumulator(columns)
+	s.grand = newAccumulator(columns)
+	s.running = make([]*big.Rat, len(s.Running))
+	for k := range s.running {
+		s.running[k] = new(big.Rat)
+	}
+	return s
+}
+
+// add accounts for a detail row and appends the running totals.
+func (s *summing) add(vector []Field) []Field {
+	s.section.add(vector)
+	s.grand.add(vector)
+	for k, c := range s.Running {
+		if c < len(vector) && vector[c].num != nil {
+			s.running[k].Add(s.running[k], vector[c].num)
+		}
+	}
+	return s.pad(vector)
+}
+
+// pad appends the running totals so far to a row, so that the
+// rows the rules typeset are as wide as the detail rows.
+func (s *summing) pad(vector []Field) []Field {
+	for k, c := range s.Running {
+		vector = append(vector, NewField("", s.running[k].FloatString(s.decimals(c))))
+	}
+	return vector
+}
+
+// decimals returns the number of decimals shown for a column.
+func (s *summing) decimals(k int) int {
+	if k < len(s.columns) {
+		return s.columns[k].Decimals
+	}
+	return 0
+}
+
+// row hands a total to the renderer. The label spans the
+// columns before the first summed one or, if the first column is
+// summed, the first run of columns that are not. If all of them
+// are summed there is no room for it and it is left out.
+func (s *summing) row(rd Renderer, label string, a *accumulator, ncols int) {
+	if len(a.columns) == 0 || a.rows == 0 {
+		return
+	}
+	values := map[int]string{}
+	for k, c := range a.columns {
+		values[c] = a.sums[k].FloatString(s.decimals(c))
+	}
+	// the running totals are not a place for the label
+	free := func(k int) bool {
+		_, summed := values[k]
+		return !summed && k < ncols && (k >= len(s.columns) || s.columns[k].Index >= 0)
+	}
+	at, span := 0, 0
+	for at < ncols && !free(at) {
+		at++
+	}
+	for free(at + span) {
+		span++
+	}
+
+	var fields []Field
+	for k := 0; k < ncols; k++ {
+		name := ""
+		if k < len(s.columns) {
+			name = s.columns[k].Name
+		}
+		fields = append(fields, NewField(name, values[k]))
+	}
+	rd.Total(label, at, span, fields)
+}
+
+// subtotal closes a section with its subtotal, if any.
+func (s *summing) subtotal(rd Renderer, ncols int) {
+	if s.Sections {
+		s.row(rd, s.SubtotalLabel, s.section, ncols)
+	}
+	s.section.reset()
+}
+
+// grandTotal ends the table with the grand total, if any.
+func (s *summing) grandTotal(rd Renderer, ncols int) {
+	if s.Grand {
+		s.row(rd, s.GrandLabel, s.grand, ncols)
+	}
+}
+
+// formatNumber typesets a number with siunitx, negative
+// numbers in red. The sign of a percentage follows it.
+func formatNumber(v string) string {
+	if p := strings.TrimSuffix(v, `\%`); p != v {
+		return formatNumber(p) + `\%`
+	}
+	v = strings.Replace(v, ",", "", -1)
+	if strings.HasPrefix(v, "-") {
+		return "\\textcolor{red}{" + `\num{` + v + `}` + "}"
+	}
+	return `\num{` + v + `}`
+}
@@ -0,0 +1,53 @@
+package table
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestTotals renders the totals computed by the package and checks
+// that the label never takes the place of a sum.
+func TestTotals(t *testing.T) {
+	const costs = "qty,item,amount\n2,Pipe,100.50\n3,Steel bolt,20.25\n"
+	tests := []struct {
+		name    string
+		format  string
+		columns []int
+		running []int
+		want    []string
+	}{
+		{"default", "markdown", nil, nil,
+			[]string{"| qty | item | amount |", "| **Grand Total** |  | 120.75 |"}},
+		{"first column summed", "markdown", []int{0, 2}, nil,
+			[]string{"| 5 | **Grand Total** | 120.75 |"}},
+		{"only the first column summed", "markdown", []int{0}, nil,
+			[]string{"| 5 | **Grand Total** |  |"}},
+		{"running", "markdown", []int{2}, []int{2},
+			[]string{"| qty | item | amount | Cumulative amount |", "| 3 | Steel bolt | 20.25 | 120.75 |", "| **Grand Total** |  | 120.75 |  |"}},
+		{"running latex", "latex", []int{0, 2}, []int{2},
+			[]string{`qty &item &amount &Cumulative amount\\`, `\num{5} &\multicolumn{1}{l}{\textbf{Grand Total}} &\num{120.75} &`}},
+		{"running html", "html", []int{0, 2}, []int{2},
+			[]string{`<th scope="col">Cumulative amount</th>`, `<td class="num">5</td><th colspan="1" scope="row">Grand Total</th><td class="num">120.75</td><td></td>`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := New()
+			tb.HasHeader = true
+			tb.Totals = Totals{Columns: tt.columns, Running: tt.running, Grand: true}
+			var err error
+			if tb.Renderer, err = NewRenderer(tt.format); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := tb.Render(&buf, strings.NewReader(costs), map[string]string{"type": "tabular"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output lacks %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
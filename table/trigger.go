@@ -0,0 +1,280 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MatchMode is the way a rule compares a cell with its words.
+type MatchMode int
+
+// Match modes for rules. The names are also accepted, in capitals,
+// as the first string of a Trigger.Names entry.
+const (
+	MatchPrefix MatchMode = iota
+	MatchContains
+	MatchExact
+	MatchRegex
+	// MatchBold matches the rows of a workbook whose cell in the
+	// column is bold, as subtotals often are. If the rule has words
+	// the cell must also start with one of them.
+	MatchBold
+)
+
+var matchModes = map[string]MatchMode{
+	"PREFIX":   MatchPrefix,
+	"CONTAINS": MatchContains,
+	"EXACT":    MatchExact,
+	"REGEX":    MatchRegex,
+	"BOLD":     MatchBold,
+}
+
+// Action is what is done with a row matched by a rule.
+type Action int
+
+// Actions a rule can take.
+const (
+	// SubtotalRow typesets the row between midrules with its label
+	// spanning a few columns. If the table has sections the next
+	// row opens a new section.
+	SubtotalRow Action = iota
+	// SectionRow replaces the row with a section heading
+	// spanning all the columns.
+	SectionRow
+	// MulticolumnRow typesets the label of the row spanning
+	// a few columns, without any rules.
+	MulticolumnRow
+	// MidruleRow draws a midrule before the row.
+	MidruleRow
+	// PageBreakRow starts a new page before the row.
+	PageBreakRow
+	// SkipRow drops the row.
+	SkipRow
+)
+
+var errInvalidRule = errors.New("invalid trigger rule")
+
+// Rule describes a trigger. When the cell in Column matches any of
+// the Words the Action is taken. For the actions that typeset a
+// label, the label is the selected cell at Start and it spans Span
+// columns formatted with Format. Label is a fmt format for the label.
+type Rule struct {
+	Column int
+	Match  MatchMode
+	Words  []string
+	Action Action
+
+	Start  int
+	Span   int
+	Format string
+	Label  string
+	// Width is the width of the midrules around a subtotal.
+	Width string
+	// MinCells, if positive, limits the rule to the
+	// records of at least that many cells.
+	MinCells int
+
+	re []*regexp.Regexp
+}
+
+// NewRule creates a rule with the layout we have always used
+// for subtotals: the label starts at the second selected column
+// and spans three columns of 3.5cm.
+func NewRule(column int, match MatchMode, action Action, words ...string) Rule {
+	return Rule{
+		Column: column,
+		Match:  match,
+		Words:  words,
+		Action: action,
+		Start:  1,
+		Span:   3,
+		Format: "|p{3.5cm}|",
+		Label:  `\textbf{%s}`,
+		Width:  "1.5pt",
+	}
+}
+
+// compile checks the rule and compiles its regular expressions.
+func (r *Rule) compile() error {
+	if r.Column < 0 {
+		return fmt.Errorf("%w: negative column %d", errInvalidRule, r.Column)
+	}
+	if r.Start < 0 {
+		return fmt.Errorf("%w: negative start %d", errInvalidRule, r.Start)
+	}
+	if r.Span < 0 {
+		return fmt.Errorf("%w: negative span %d", errInvalidRule, r.Span)
+	}
+	// the label is a format of the cell, a single %s and %% for a percent
+	if verbs := strings.Replace(r.Label, "%%", "", -1); r.Label != "" &&
+		(strings.Count(verbs, "%") != 1 || !strings.Contains(verbs, "%s")) {
+		return fmt.Errorf("%w: label %q needs a single %%s for the cell", errInvalidRule, r.Label)
+	}
+	if r.Match != MatchRegex {
+		return nil
+	}
+	r.re = nil
+	for _, word := range r.Words {
+		re, err := regexp.Compile(word)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidRule, err)
+		}
+		r.re = append(r.re, re)
+	}
+	return nil
+}
+
+// Matches reports if the rule is triggered by a record. A record
+// without the column of the rule never matches, nor does a record
+// match MatchBold, which needs the cells, see MatchesRow.
+func (r *Rule) Matches(record []string) bool {
+	return r.matches(record, nil)
+}
+
+// MatchesRow reports if the rule is triggered by a row of cells.
+func (r *Rule) MatchesRow(row []Field) bool {
+	return r.matches(Values(row), row)
+}
+
+func (r *Rule) matches(record []string, row []Field) bool {
+	if r.Column >= len(record) || len(record) < r.MinCells {
+		return false
+	}
+	cell := strings.TrimSpace(record[r.Column])
+	if r.Match == MatchBold {
+		if r.Column >= len(row) || !row[r.Column].bold || cell == "" {
+			return false
+		}
+		if len(r.Words) == 0 {
+			return true
+		}
+		for _, word := range r.Words {
+			if strings.HasPrefix(cell, word) {
+				return true
+			}
+		}
+		return false
+	}
+	if r.Match == MatchRegex {
+		for _, re := range r.re {
+			if re.MatchString(cell) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, word := range r.Words {
+		switch {
+		case r.Match == MatchPrefix && strings.HasPrefix(cell, word),
+			r.Match == MatchContains && strings.Contains(cell, word),
+			r.Match == MatchExact && cell == word:
+			return true
+		}
+	}
+	return false
+}
+
+// multicolumn typesets a row with the label spanning Span columns.
+func (r *Rule) multicolumn(vector []string) string {
+	if len(vector) == 0 {
+		return ""
+	}
+	start := r.Start
+	if start >= len(vector) {
+		start = len(vector) - 1
+	}
+	span := r.Span
+	if span < 1 {
+		span = 1
+	}
+	if start+span > len(vector) {
+		span = len(vector) - start
+	}
+	format := r.Format
+	if format == "" {
+		format = "l"
+	}
+	label := r.Label
+	if label == "" {
+		label = "%s"
+	}
+
+	s := strings.Join(vector[:start], " &")
+	if start > 0 {
+		s += "&"
+	}
+	s += `\multicolumn{` + strconv.Itoa(span) + `}{` + format + `}{` + fmt.Sprintf(label, vector[start]) + `}`
+	for _, v := range vector[start+span:] {
+		s += " &" + v
+	}
+	return s + " \\\\\n"
+}
+
+// DefaultRules are used when neither Rules nor Names have been
+// set. They keep what SectionCSV has always done: the rows of more
+// than eight cells without a serial number, the first, or a cost, the
+// ninth, are notes and are dropped, and the rows whose second cell
+// starts with one of the words of our cost reports are subtotals.
+var DefaultRules = []Rule{
+	{Column: 0, Match: MatchExact, Words: []string{""}, Action: SkipRow, MinCells: 9},
+	{Column: 8, Match: MatchExact, Words: []string{""}, Action: SkipRow, MinCells: 9},
+	NewRule(1, MatchPrefix, SubtotalRow, "SUBTOTAL", "SUBCONTRACTS", "MATERIALS",
+		"TEC-VAR", "CONTRACTS", "CINEMA", "GRAND", "TOTAL"),
+}
+
+// AddRule adds a rule. Rules are tried in the order they
+// were added and the first one that matches wins.
+func (tr *Trigger) AddRule(r Rule) {
+	tr.Rules = append(tr.Rules, r)
+}
+
+// rules returns the rules in use. The Names map is a shorthand
+// for subtotal rules: the key is the column and the strings are the
+// match mode followed by the words, as in
+//
+//	1: {"PREFIX", "SUBTOTAL", "TOTAL"}
+func (tr *Trigger) rules() ([]Rule, error) {
+	list := append([]Rule(nil), tr.Rules...)
+	columns := make([]int, 0, len(tr.Names))
+	for column := range tr.Names {
+		columns = append(columns, column)
+	}
+	sort.Ints(columns)
+	for _, column := range columns {
+		names := tr.Names[column]
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w: Names[%d] needs a match mode and at least one word", errInvalidRule, column)
+		}
+		mode, ok := matchModes[strings.ToUpper(names[0])]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown match mode %q", errInvalidRule, names[0])
+		}
+		if len(names) < 2 && mode != MatchBold {
+			return nil, fmt.Errorf("%w: Names[%d] needs a match mode and at least one word", errInvalidRule, column)
+		}
+		list = append(list, NewRule(column, mode, SubtotalRow, names[1:]...))
+	}
+	if len(list) == 0 {
+		list = append(list, DefaultRules...)
+	}
+	for k := range list {
+		if err := list[k].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// match returns the first rule triggered by the row, or nil.
+func match(list []Rule, record []string, row []Field) *Rule {
+	for k := range list {
+		if list[k].matches(record, row) {
+			return &list[k]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package table
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Default timings of a Watcher.
+const (
+	watchInterval = 500 * time.Millisecond
+	watchDebounce = time.Second
+)
+
+// Watcher renders jobs again whenever their input changes. It
+// polls the inputs, which works the same on every system and on
+// network drives, and is cheap for the few files of a report.
+type Watcher struct {
+	// Interval is the time between two looks at the
+	// inputs, half a second if zero.
+	Interval time.Duration
+	// Debounce is how long an input must stay unchanged before
+	// its jobs are rendered, a second if zero. Excel saves a
+	// file in several writes, and people save several times in
+	// a row; each burst of changes renders the jobs only once.
+	Debounce time.Duration
+	// Report, if not nil, is called after each job
+	// rendered, with its error.
+	Report func(j *Job, err error)
+}
+
+// stamp is what the watcher knows of an input file.
+type stamp struct {
+	mod  time.Time
+	size int64
+	ok   bool
+}
+
+func statStamp(name string) stamp {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{fi.ModTime(), fi.Size(), true}
+}
+
+// input is a watched input and the jobs that read it.
+type input struct {
+	last    stamp
+	changed time.Time
+	pending bool
+	jobs    []*Job
+}
+
+// Watch renders the jobs whose output is missing or older than their
+// input, then watches the inputs and renders the jobs of an input
+// whenever it changes, until ctx is cancelled. Only the jobs of the
+// inputs changed are rendered. The outputs are replaced atomically,
+// so that a LaTeX run at the same time never reads half a table.
+// A job that fails is reported and rendered again at the next
+// change. Watch returns the error of ctx.
+func (w *Watcher) Watch(ctx context.Context, jobs ...*Job) error {
+	interval, debounce := w.Interval, w.Debounce
+	if interval <= 0 {
+		interval = watchInterval
+	}
+	if debounce <= 0 {
+		debounce = watchDebounce
+	}
+
+	inputs := map[string]*input{}
+	var order []string
+	var stale []*Job
+	for _, j := range jobs {
+		in, ok := inputs[j.Input]
+		if !ok {
+			in = &input{last: statStamp(j.Input)}
+			inputs[j.Input] = in
+			order = append(order, j.Input)
+		}
+		in.jobs = append(in.jobs, j)
+		if out := statStamp(j.Output); !out.ok || out.mod.Before(in.last.mod) {
+			stale = append(stale, j)
+		}
+	}
+	w.render(ctx, stale)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			var due []*Job
+			for _, name := range order {
+				in := inputs[name]
+				if s := statStamp(name); s != in.last {
+					in.last, in.changed, in.pending = s, now, true
+					continue
+				}
+				// a file being replaced may be missing for
+				// a moment; wait until it is back
+				if in.pending && in.last.ok && now.Sub(in.changed) >= debounce {
+					in.pending = false
+					due = append(due, in.jobs...)
+				}
+			}
+			w.render(ctx, due)
+		}
+	}
+}
+
+// render renders the jobs concurrently and reports them.
+func (w *Watcher) render(ctx context.Context, jobs []*Job) {
+	if len(jobs) == 0 {
+		return
+	}
+	errs := Batch(ctx, 0, jobs...)
+	if w.Report == nil {
+		return
+	}
+	for k, j := range jobs {
+		w.Report(j, errs[k])
+	}
+}
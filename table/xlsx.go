@@ -0,0 +1,545 @@
+package table
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSX reads a sheet of an excel workbook, with what the export to
+// csv loses: the typed values and number formats of the cells, the
+// merged regions and the bold font of the subtotal rows, see
+// MatchBold. The sheet and the range are selected by SheetOptions.
+type XLSX struct {
+	SheetOptions
+	LineOptions
+}
+
+func (x *XLSX) binary() {}
+
+// Open reads the workbook r and returns a reader of the rows
+// of the sheet. Errors are returned by the first Read.
+func (x *XLSX) Open(r io.Reader) RecordReader {
+	s, err := ReadXLSX(r, x.SheetOptions, x.FillMerged)
+	if err != nil {
+		return failedReader{err}
+	}
+	return newSheetReader(s, x.LineOptions)
+}
+
+type xlsxWorkbook struct {
+	Pr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// r:id, whose namespace differs in strict files
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+// text returns the text of a string, made of runs if it has rich text.
+func (t xlsxText) text() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	Fonts []struct {
+		B *struct {
+			Val string `xml:"val,attr"`
+		} `xml:"b"`
+	} `xml:"fonts>font"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+		FontID   int `xml:"fontId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string   `xml:"r,attr"`
+			S  int      `xml:"s,attr"`
+			T  string   `xml:"t,attr"`
+			V  string   `xml:"v"`
+			Is xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+	Merges []struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"mergeCells>mergeCell"`
+}
+
+// builtinFormats are the number formats excel does not write in the
+// workbook. The short date, 14, depends on the locale, ISO is used.
+var builtinFormats = map[int]string{
+	0: "General", 1: "0", 2: "0.00", 3: "#,##0", 4: "#,##0.00",
+	9: "0%", 10: "0.00%", 11: "0.00E+00", 12: "# ?/?", 13: "# ??/??",
+	14: "yyyy-mm-dd", 15: "d-mmm-yy", 16: "d-mmm", 17: "mmm-yy",
+	18: "h:mm AM/PM", 19: "h:mm:ss AM/PM", 20: "h:mm", 21: "h:mm:ss",
+	22: "yyyy-mm-dd h:mm", 37: "#,##0 ;(#,##0)", 38: "#,##0 ;[Red](#,##0)",
+	39: "#,##0.00;(#,##0.00)", 40: "#,##0.00;[Red](#,##0.00)",
+	45: "mm:ss", 46: "[h]:mm:ss", 47: "mmss.0", 48: "##0.0E+0", 49: "@",
+}
+
+// xlsxStyle is what the table uses of the style of a cell.
+type xlsxStyle struct {
+	format string
+	nf     numberFormat
+	bold   bool
+}
+
+// ReadXLSX reads a sheet of the excel workbook r, as the options
+// select it. With fill, the merged regions are filled with their value.
+func ReadXLSX(r io.Reader, opt SheetOptions, fill bool) (*Sheet, error) {
+	z, err := readZip(r)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	}
+	var wb xlsxWorkbook
+	if ok, err := zipXML(z, "xl/workbook.xml", &wb); err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	} else if !ok {
+		return nil, fmt.Errorf("xlsx: not an excel workbook, xl/workbook.xml is missing")
+	}
+	names := make([]string, len(wb.Sheets))
+	for k, s := range wb.Sheets {
+		names[k] = s.Name
+	}
+	k, err := opt.pickSheet(names)
+	if err != nil {
+		return nil, err
+	}
+	member, err := sheetMember(z, wb.Sheets[k].Attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var sst xlsxStrings
+	if _, err := zipXML(z, "xl/sharedStrings.xml", &sst); err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	}
+	var st xlsxStyles
+	if _, err := zipXML(z, "xl/styles.xml", &st); err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	}
+	styles := resolveStyles(st)
+
+	var xs xlsxSheet
+	if ok, err := zipXML(z, member, &xs); err != nil {
+		return nil, fmt.Errorf("xlsx: %v", err)
+	} else if !ok {
+		return nil, fmt.Errorf("xlsx: %s is missing", member)
+	}
+
+	date1904 := wb.Pr.Date1904 == "1" || wb.Pr.Date1904 == "true"
+	sheet := &Sheet{Name: names[k]}
+	row := -1
+	for _, xr := range xs.Rows {
+		row++
+		if xr.R > 0 {
+			row = xr.R - 1
+		}
+		var cells []Cell
+		col := -1
+		for _, xc := range xr.Cells {
+			col++
+			if r, c, ok := parseCell(xc.R); ok {
+				row, col = r, c
+			}
+			c := Cell{Row: row, Col: col}
+			var style xlsxStyle
+			if xc.S >= 0 && xc.S < len(styles) {
+				style = styles[xc.S]
+			}
+			c.Format = style.format
+			switch xc.T {
+			case "s":
+				if n, err := strconv.Atoi(xc.V); err == nil && n >= 0 && n < len(sst.Items) {
+					c.Field = NewField("", sst.Items[n].text())
+				}
+			case "inlineStr":
+				c.Field = NewField("", xc.Is.text())
+			case "str":
+				c.Field = NewField("", xc.V)
+			case "b":
+				c.Field = Field{Value: "FALSE", t: CodeCell}
+				if xc.V == "1" {
+					c.Field.Value = "TRUE"
+				}
+			case "e":
+				c.Field = Field{Value: xc.V, t: ErrorCell}
+			case "d":
+				if d, err := time.Parse("2006-01-02T15:04:05", strings.TrimSuffix(xc.V, "Z")); err == nil {
+					c.Field = dateCell(d, style.nf)
+				} else {
+					c.Field = NewField("", xc.V)
+				}
+			default:
+				c.Field = xlsxNumber(xc.V, style.nf, date1904)
+			}
+			c.bold = style.bold
+			cells = append(cells, c)
+		}
+		sheet.Rows = append(sheet.Rows, cells)
+	}
+	for _, m := range xs.Merges {
+		if r, err := ParseRange(m.Ref); err == nil && r.LastRow >= 0 && r.LastCol >= 0 {
+			sheet.Merged = append(sheet.Merged, r)
+		}
+	}
+	if err := opt.finish(sheet, fill); err != nil {
+		return nil, err
+	}
+	return sheet, nil
+}
+
+// sheetMember returns the member of the archive that holds
+// the sheet with the relationship among attrs.
+func sheetMember(z *zip.Reader, attrs []xml.Attr) (string, error) {
+	id := ""
+	for _, a := range attrs {
+		if a.Name.Local == "id" {
+			id = a.Value
+		}
+	}
+	var rels xlsxRels
+	if _, err := zipXML(z, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", fmt.Errorf("xlsx: %v", err)
+	}
+	for _, rel := range rels.Rels {
+		if rel.ID != id {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", fmt.Errorf("xlsx: no worksheet for the sheet %s", id)
+}
+
+// resolveStyles resolves the number format and the font of every
+// cell style of the workbook.
+func resolveStyles(st xlsxStyles) []xlsxStyle {
+	codes := map[int]string{}
+	for id, code := range builtinFormats {
+		codes[id] = code
+	}
+	for _, f := range st.NumFmts {
+		codes[f.ID] = f.Code
+	}
+	styles := make([]xlsxStyle, len(st.CellXfs))
+	for k, xf := range st.CellXfs {
+		code := codes[xf.NumFmtID]
+		styles[k] = xlsxStyle{format: code, nf: parseNumberFormat(code)}
+		if xf.FontID >= 0 && xf.FontID < len(st.Fonts) {
+			if b := st.Fonts[xf.FontID].B; b != nil && b.Val != "0" && b.Val != "false" {
+				styles[k].bold = true
+			}
+		}
+	}
+	return styles
+}
+
+// xlsxNumber returns the cell of a number stored in
+// the workbook, a serial date if its format is one.
+func xlsxNumber(v string, nf numberFormat, date1904 bool) Field {
+	if v == "" {
+		return Field{}
+	}
+	num, ok := new(big.Rat).SetString(v)
+	if !ok {
+		return NewField("", v)
+	}
+	if nf.layout != "" {
+		f, _ := num.Float64()
+		return dateCell(serialDate(f, date1904), nf)
+	}
+	if nf.text {
+		return NewField("", v)
+	}
+	return numberCell(num, nf)
+}
+
+// serialDate converts the serial number of a date: days since the
+// end of 1899, or since 1904 in the workbooks of old Macs.
+func serialDate(days float64, date1904 bool) time.Time {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if days < 60 {
+		// excel counts a 29 February 1900 that never was
+		base = base.AddDate(0, 0, 1)
+	}
+	ms := int64(days*86400000 + 0.5)
+	return base.Add(time.Duration(ms) * time.Millisecond)
+}
+
+// dateCell returns the cell of a date, in the layout of its format.
+func dateCell(d time.Time, nf numberFormat) Field {
+	layout := nf.layout
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+	f := Field{Value: d.Format(layout), date: d, t: DateCell}
+	if !nf.date {
+		// a time of day or a duration
+		f.t = DetectType(f.Value)
+	}
+	return f
+}
+
+// numberFormat is what the table uses of a number format of a
+// spreadsheet: the decimals, -1 as in General, the grouping of the
+// thousands, a percentage or a currency, or the layout of a date.
+type numberFormat struct {
+	decimals int
+	grouping bool
+	percent  bool
+	currency string
+	text     bool
+	// layout is the time layout of the dates and times,
+	// date is set if it has a date and not only a time
+	layout string
+	date   bool
+}
+
+// currencyRunes are the currency symbols met as
+// literals in number formats.
+const currencyRunes = "$€£¥"
+
+// parseNumberFormat parses the first section of a number format,
+// the one of the positive numbers, as #,##0.00 or d-mmm-yy.
+func parseNumberFormat(code string) numberFormat {
+	nf := numberFormat{decimals: -1}
+	switch {
+	case code == "" || strings.EqualFold(code, "General"):
+		return nf
+	case code == "@":
+		nf.text = true
+		return nf
+	}
+
+	var tokens []string // the letters of dates and the literals
+	digits, inFrac, frac, exp := false, false, 0, false
+	rs := []rune(code)
+	literal := func(s string) {
+		tokens = append(tokens, "'"+s)
+		if strings.ContainsAny(s, currencyRunes) || isCurrencyCode(s) {
+			nf.currency = strings.TrimSpace(s)
+		}
+	}
+loop:
+	for k := 0; k < len(rs); k++ {
+		r := rs[k]
+		switch {
+		case r == ';':
+			break loop
+		case r == '"':
+			j := k + 1
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			literal(string(rs[k+1 : min(j, len(rs))]))
+			k = j
+		case r == '\\' && k+1 < len(rs):
+			k++
+			literal(string(rs[k]))
+		case r == '_' || r == '*':
+			k++ // padding the width of the next character
+		case r == '[':
+			j := k + 1
+			for j < len(rs) && rs[j] != ']' {
+				j++
+			}
+			inner := string(rs[k+1 : min(j, len(rs))])
+			switch {
+			case strings.HasPrefix(inner, "$"):
+				// [$€-407], a currency and its locale
+				sym := inner[1:]
+				if n := strings.Index(sym, "-"); n >= 0 {
+					sym = sym[:n]
+				}
+				if sym != "" {
+					nf.currency = sym
+				}
+			case strings.Trim(strings.ToLower(inner), "hms") == "":
+				// elapsed time, [h]:mm
+				tokens = append(tokens, strings.ToLower(inner))
+			}
+			k = j
+		case r == '0' || r == '#' || r == '?':
+			digits = true
+			if inFrac {
+				frac++
+			}
+		case r == '.' && k+1 < len(rs) && strings.ContainsRune("0#?", rs[k+1]):
+			inFrac = true
+			tokens = append(tokens, "'.")
+		case r == ',' && digits && !inFrac && k+1 < len(rs) && strings.ContainsRune("0#?", rs[k+1]):
+			nf.grouping = true
+		case r == '%':
+			nf.percent = true
+		case (r == 'E' || r == 'e') && digits:
+			exp = true
+		case strings.ContainsRune(currencyRunes, r):
+			nf.currency = string(r)
+		case strings.HasPrefix(strings.ToUpper(string(rs[k:])), "AM/PM"):
+			tokens = append(tokens, "PM")
+			k += 4
+		case strings.HasPrefix(strings.ToUpper(string(rs[k:])), "A/P"):
+			tokens = append(tokens, "PM")
+			k += 2
+		case strings.ContainsRune("ymdhsYMDHS", r):
+			j := k
+			for j < len(rs) && (rs[j]|0x20) == (r|0x20) {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(string(rs[k:j])))
+			k = j - 1
+		default:
+			tokens = append(tokens, "'"+string(r))
+		}
+	}
+	if !digits {
+		nf.layout, nf.date = timeLayout(tokens)
+	}
+	if digits && !exp {
+		nf.decimals = frac
+	}
+	return nf
+}
+
+// isCurrencyCode reports whether s is one of the currencies
+// DetectType knows, as "USD" or "QAR".
+func isCurrencyCode(s string) bool {
+	s = strings.TrimSpace(s)
+	for _, c := range currencySymbols {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// timeLayout converts the tokens of a date format to a time layout.
+// It returns an empty layout if there is no date or time in them.
+func timeLayout(tokens []string) (layout string, date bool) {
+	ampm := false
+	for _, tok := range tokens {
+		if tok == "PM" {
+			ampm = true
+		}
+	}
+	// a m next to an hour or a second is a minute
+	kind := func(k int) byte {
+		if k < 0 || k >= len(tokens) || tokens[k][0] == '\'' || tokens[k] == "PM" {
+			return 0
+		}
+		return strings.Trim(tokens[k], "[]")[0]
+	}
+	near := func(k, step int) byte {
+		for k += step; k >= 0 && k < len(tokens); k += step {
+			if c := kind(k); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+
+	var b strings.Builder
+	found := false
+	for k, tok := range tokens {
+		if tok[0] == '\'' {
+			b.WriteString(tok[1:])
+			continue
+		}
+		if tok == "PM" {
+			b.WriteString("PM")
+			continue
+		}
+		found = true
+		n := len(tok)
+		switch tok[0] {
+		case 'y':
+			date = true
+			if n <= 2 {
+				b.WriteString("06")
+			} else {
+				b.WriteString("2006")
+			}
+		case 'd':
+			date = true
+			b.WriteString([]string{"2", "02", "Mon", "Monday"}[min(n, 4)-1])
+		case 'm':
+			if near(k, -1) == 'h' || near(k, 1) == 's' {
+				b.WriteString([]string{"4", "04"}[min(n, 2)-1])
+				continue
+			}
+			date = true
+			b.WriteString([]string{"1", "01", "Jan", "January", "Jan"}[min(n, 5)-1])
+		case 'h':
+			switch {
+			case ampm && n == 1:
+				b.WriteString("3")
+			case ampm:
+				b.WriteString("03")
+			default:
+				b.WriteString("15")
+			}
+		case 's':
+			b.WriteString([]string{"5", "05"}[min(n, 2)-1])
+		case '[':
+			// elapsed hours, minutes or seconds
+			b.WriteString(map[byte]string{'h': "15", 'm': "04", 's': "05"}[kind(k)])
+		}
+	}
+	if !found {
+		return "", false
+	}
+	return b.String(), date
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
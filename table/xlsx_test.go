@@ -0,0 +1,249 @@
+package table
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipOf returns an archive of the files, name to content.
+func zipOf(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const xlsxStylesXML = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts>
+<numFmt numFmtId="164" formatCode="[$€-407]#,##0.00"/>
+<numFmt numFmtId="165" formatCode="d-mmm-yy"/>
+<numFmt numFmtId="166" formatCode="&quot;QAR&quot; #,##0"/>
+</numFmts>
+<fonts><font/><font><b/></font></fonts>
+<cellXfs>
+<xf numFmtId="0" fontId="0"/>
+<xf numFmtId="3" fontId="0"/>
+<xf numFmtId="4" fontId="0"/>
+<xf numFmtId="10" fontId="0"/>
+<xf numFmtId="164" fontId="0"/>
+<xf numFmtId="14" fontId="0"/>
+<xf numFmtId="165" fontId="0"/>
+<xf numFmtId="0" fontId="1"/>
+<xf numFmtId="49" fontId="0"/>
+<xf numFmtId="22" fontId="0"/>
+<xf numFmtId="166" fontId="0"/>
+</cellXfs>
+</styleSheet>`
+
+// workbook returns an excel workbook of a single sheet, Costs, with
+// the rows of its sheetData and the merges given.
+func workbook(t *testing.T, date1904 bool, rows, merges string) []byte {
+	pr := ""
+	if date1904 {
+		pr = `<workbookPr date1904="1"/>`
+	}
+	return zipOf(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			pr + `<sheets><sheet name="Costs" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>Pipe</t></si><si><r><t>Steel </t></r><r><t>bolt</t></r></si></sst>`,
+		"xl/styles.xml": xlsxStylesXML,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			rows + `</sheetData>` + merges + `</worksheet>`,
+	})
+}
+
+func TestReadXLSXValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		cell     string // the attributes and content of <c>
+		date1904 bool
+		want     string
+		typ      CellType
+	}{
+		{"general", `><v>1234.5</v>`, false, "1234.5", DecimalCell},
+		{"general float", `><v>0.30000000000000004</v>`, false, "0.3", DecimalCell},
+		{"integer", `><v>42</v>`, false, "42", IntegerCell},
+		{"thousands", ` s="1"><v>1234567</v>`, false, "1,234,567", IntegerCell},
+		{"decimals", ` s="2"><v>1234.5</v>`, false, "1,234.50", DecimalCell},
+		{"percent", ` s="3"><v>0.125</v>`, false, "12.50%", DecimalCell},
+		{"currency", ` s="4"><v>1500</v>`, false, "€1,500.00", CurrencyCell},
+		{"currency code", ` s="10"><v>1500</v>`, false, "QAR 1,500", CurrencyCell},
+		{"text format", ` s="8"><v>00123</v>`, false, "00123", IntegerCell},
+		{"shared string", ` t="s"><v>0</v>`, false, "Pipe", CodeCell},
+		{"rich text", ` t="s"><v>1</v>`, false, "Steel bolt", TextCell},
+		{"inline string", ` t="inlineStr"><is><t>Hex nut</t></is>`, false, "Hex nut", TextCell},
+		{"boolean", ` t="b"><v>1</v>`, false, "TRUE", CodeCell},
+		{"error", ` t="e"><v>#DIV/0!</v>`, false, "#DIV/0!", ErrorCell},
+		{"date", ` s="5"><v>45000</v>`, false, "2023-03-15", DateCell},
+		{"date format", ` s="6"><v>45000</v>`, false, "15-Mar-23", DateCell},
+		{"date and time", ` s="9"><v>45000.75</v>`, false, "2023-03-15 18:00", DateCell},
+		{"date before march 1900", ` s="5"><v>59</v>`, false, "1900-02-28", DateCell},
+		{"date after march 1900", ` s="5"><v>61</v>`, false, "1900-03-01", DateCell},
+		{"date 1904", ` s="5"><v>43538</v>`, true, "2023-03-15", DateCell},
+		{"date 1904 epoch", ` s="5"><v>0</v>`, true, "1904-01-01", DateCell},
+		{"iso date", ` t="d" s="5"><v>2023-03-15T00:00:00</v>`, false, "2023-03-15", DateCell},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wb := workbook(t, tt.date1904, `<row r="1"><c r="A1"`+tt.cell+`</c></row>`, "")
+			s, err := ReadXLSX(bytes.NewReader(wb), SheetOptions{}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Rows) != 1 || len(s.Rows[0]) != 1 {
+				t.Fatalf("read %d rows, want one cell", len(s.Rows))
+			}
+			c := s.Rows[0][0]
+			if c.Value != tt.want || c.Type() != tt.typ {
+				t.Errorf("cell %q, %v, want %q, %v", c.Value, c.Type(), tt.want, tt.typ)
+			}
+			if d, ok := c.Date(); ok && tt.typ == DateCell && d.Year() < 1900 {
+				t.Errorf("date %v", d)
+			}
+		})
+	}
+}
+
+// costs is a sheet with a bold header and subtotal, a category
+// merged down two rows, styled cells without a value far to the
+// right and below, and a note merged to the end of the sheet.
+const costs = `<row r="1"><c r="A1" t="inlineStr" s="7"><is><t>Group</t></is></c><c r="B1" t="inlineStr" s="7"><is><t>Item</t></is></c><c r="C1" t="inlineStr" s="7"><is><t>Cost</t></is></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>Civil</t></is></c><c r="B2" t="s"><v>0</v></c><c r="C2" s="2"><v>100</v></c><c r="XFD2" s="3"/></row>
+<row r="3"><c r="A3" s="7"/><c r="B3" t="s"><v>1</v></c><c r="C3" s="2"><v>50</v></c></row>
+<row r="4"><c r="A4" t="inlineStr" s="7"><is><t>SUBTOTAL</t></is></c><c r="C4" s="7"><v>150</v></c></row>
+<row r="5"><c r="A5" t="inlineStr"><is><t>Rates as tendered</t></is></c></row>
+<row r="1048576"><c r="XFD1048576" s="3"/></row>`
+
+const costsMerges = `<mergeCells><mergeCell ref="A2:A3"/><mergeCell ref="A5:XFD1048576"/></mergeCells>`
+
+func TestReadXLSXLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   SheetOptions
+		fill  bool
+		cells [][]string
+	}{
+		{"sheet", SheetOptions{}, false, [][]string{
+			{"Group", "Item", "Cost"},
+			{"Civil", "Pipe", "100.00"},
+			{"", "Steel bolt", "50.00"},
+			{"SUBTOTAL", "", "150"},
+			{"Rates as tendered", "", ""},
+		}},
+		{"filled", SheetOptions{Sheet: "costs"}, true, [][]string{
+			{"Group", "Item", "Cost"},
+			{"Civil", "Pipe", "100.00"},
+			{"Civil", "Steel bolt", "50.00"},
+			{"SUBTOTAL", "", "150"},
+			{"Rates as tendered", "Rates as tendered", "Rates as tendered"},
+		}},
+		{"range", SheetOptions{Sheet: "1", Range: "A2:B3"}, true, [][]string{
+			{"Civil", "Pipe"},
+			{"Civil", "Steel bolt"},
+		}},
+		{"range below the merge", SheetOptions{Range: "A3:C5"}, true, [][]string{
+			{"", "Steel bolt", "50.00"},
+			{"SUBTOTAL", "", "150"},
+			{"Rates as tendered", "Rates as tendered", "Rates as tendered"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wb := workbook(t, false, costs, costsMerges)
+			done := make(chan struct{})
+			var s *Sheet
+			var err error
+			go func() {
+				s, err = ReadXLSX(bytes.NewReader(wb), tt.opt, tt.fill)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("the merge of the whole sheet is walked cell by cell")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]string
+			for _, row := range s.Rows {
+				got = append(got, Values(cellFields(row)))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.cells) {
+				t.Errorf("cells %q, want %q", got, tt.cells)
+			}
+		})
+	}
+
+	s, err := ReadXLSX(bytes.NewReader(workbook(t, false, costs, costsMerges)), SheetOptions{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := s.Rows[1][0]; c.RowSpan != 2 || c.ColSpan != 1 || c.Merged {
+		t.Errorf("A2 spans %dx%d, merged %v, want 2x1 and not merged", c.RowSpan, c.ColSpan, c.Merged)
+	}
+	if c := s.Rows[2][0]; !c.Merged {
+		t.Errorf("A3 is not merged")
+	}
+	// the merge of the whole sheet is clipped to the cells read
+	if c := s.Rows[4][0]; c.RowSpan != 1 || c.ColSpan != 3 {
+		t.Errorf("A5 spans %dx%d, want 1x3", c.RowSpan, c.ColSpan)
+	}
+	for k, bold := range []bool{true, false, false, true, false} {
+		if s.Rows[k][0].Bold() != bold {
+			t.Errorf("row %d: bold %v, want %v", k+1, !bold, bold)
+		}
+	}
+}
+
+// cellFields returns the fields of the cells of a row.
+func cellFields(cells []Cell) []Field {
+	fields := make([]Field, len(cells))
+	for k, c := range cells {
+		fields[k] = c.Field
+	}
+	return fields
+}
+
+// TestXLSXBoldSubtotals renders a workbook whose subtotals are
+// found by their bold font rather than their text.
+func TestXLSXBoldSubtotals(t *testing.T) {
+	tb := New()
+	tb.HasHeader = true
+	tb.Input = &XLSX{}
+	rule := NewRule(0, MatchBold, SubtotalRow)
+	rule.Start, rule.Span = 0, 2
+	tb.AddRule(rule)
+	var err error
+	if tb.Renderer, err = NewRenderer("markdown"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tb.RenderSections(&buf, bytes.NewReader(workbook(t, false, costs, costsMerges)), map[string]string{"type": "tabular"}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"| Civil | Pipe |", "|  | Steel bolt |", "| **SUBTOTAL** |  | 150 |"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}